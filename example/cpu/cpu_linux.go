@@ -3,7 +3,9 @@ package cpu
 
 import (
 	"bufio"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -28,47 +30,71 @@ type CPUStats struct {
 	GuestNice   uint64 `column:"guest_nice,format=%.2f %%"`
 }
 
-// one entry for each CPU row in /proc/stats
+// cpustat holds the previous sample of each CPU row in /proc/stat. It
+// is saved so that a restarted sampler publishes from its first sample.
 type cpustat struct {
-	cpus       map[string]CPUStats
-	lastsample time.Time
+	baseline *samplers.Baseline[map[string]CPUStats]
 }
 
 func (p *CPUSampler) DoSample() (err error) {
 	DebugLogger.Print("called")
-	laststats := p.cpustats
-	if laststats.lastsample.IsZero() {
-		// first time through, store initial stats, don't update table and wait for next call
-		var stat cpustat
-		err = parsestats(&stat)
+	if p.cpustats.baseline == nil {
+		path, err := p.baselinePath()
 		if err != nil {
-			return
-		}
-		p.cpustats = stat
-	} else {
-		// calculate diff and publish
-		var stat cpustat
-
-		err = parsestats(&stat)
-		if err != nil {
-			return
+			return err
 		}
+		p.cpustats.baseline = samplers.NewBaseline[map[string]CPUStats](path, 3*p.Interval())
+	}
+	cpus, now, err := parsestats()
+	if err != nil {
+		return
+	}
+	// nothing is published until there is a previous sample to compare with
+	return p.cpustats.baseline.UpdateTable(p.View, cpus, now)
+}
 
-		interval := stat.lastsample.Sub(laststats.lastsample)
-		err = p.UpdateTableFromMapDelta(stat.cpus, laststats.cpus, interval)
-		p.cpustats = stat
+// baselinePath returns the file the previous sample is saved in, from
+// the BASELINE_FILE parameter or else one for each Netprobe, entity,
+// sampler and dataview under the user's cache directory, so that
+// samplers never share a baseline
+func (p *CPUSampler) baselinePath() (path string, err error) {
+	if path, err = p.ParameterString("BASELINE_FILE"); err != nil || path != "" {
+		return
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return
+	}
+	u, err := url.Parse(p.URL())
+	if err != nil {
+		return
 	}
+	dir := filepath.Join(cache, "geneos", "cpu", pathName(u.Host),
+		pathName(p.EntityName()), pathName(p.SamplerName()))
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	return filepath.Join(dir, pathName(p.DataviewName())+".json"), nil
+}
 
-	return
+// pathName escapes name for use as one element of a path, so that no
+// name can add or leave a directory and different names never clash
+func pathName(name string) string {
+	if strings.Trim(name, ".") == "" {
+		// "", "." and "..", which PathEscape() leaves alone. It never
+		// returns "%%" so these can't clash with other names
+		return "%" + strings.ReplaceAll(name, ".", "%2E")
+	}
+	return url.PathEscape(name)
 }
 
-func parsestats(c *cpustat) (err error) {
+func parsestats() (cpus map[string]CPUStats, now time.Time, err error) {
 	stats, err := os.Open("/proc/stat")
 	if err != nil {
 		return
 	}
-	c.lastsample = time.Now()
-	c.cpus = make(map[string]CPUStats)
+	now = time.Now()
+	cpus = make(map[string]CPUStats)
 	defer stats.Close()
 
 	lines := bufio.NewScanner(stats)
@@ -95,12 +121,12 @@ func parsestats(c *cpustat) (err error) {
 			cpu.GuestNice, _ = strconv.ParseUint(fields[10], 10, 0)
 
 			cpu.Utilisation = cpu.User + cpu.Nice + cpu.System + cpu.IRQ + cpu.SoftIRQ + cpu.Steal + cpu.Guest + cpu.GuestNice
-			c.cpus[cpuname] = cpu
+			cpus[cpuname] = cpu
 		}
 	}
 	return
 }
 
-func (p CPUSampler) initColumns() (cols samplers.Columns, columnnames []string, sortcol string, err error) {
+func (p *CPUSampler) initColumns() (cols samplers.Columns, columnnames []string, sortcol string, err error) {
 	return p.ColumnInfo(CPUStats{})
 }
@@ -77,6 +77,6 @@ func getstats(c *cpustat) (err error) {
 	return
 }
 
-func (p CPUSampler) initColumns() (cols samplers.Columns, columnnames []string, sortcol string, err error) {
+func (p *CPUSampler) initColumns() (cols samplers.Columns, columnnames []string, sortcol string, err error) {
 	return p.ColumnInfo(Win32_PerfRawData_PerfOS_Processor{})
 }
@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"wonderland.org/geneos/plugins"
+	"wonderland.org/geneos/shutdown"
 	"wonderland.org/geneos/streams"
+	"wonderland.org/geneos/xmlrpc"
 
 	"example/cpu"
 	"example/generic"
@@ -27,6 +29,7 @@ func main() {
 		hostname                string
 		port                    uint
 		entityname, samplername string
+		keyfile                 string
 	)
 
 	flag.StringVar(&hostname, "h", "localhost", "Netprobe hostname")
@@ -34,12 +37,23 @@ func main() {
 	flag.DurationVar(&interval, "t", 1*time.Second, "Globval DoSample Interval (min 1s)")
 	flag.StringVar(&entityname, "e", "", "Default entity to connect")
 	flag.StringVar(&samplername, "s", "", "Default sampler to connect")
+	flag.StringVar(&keyfile, "k", "", "Geneos key file to decrypt parameters, default $GENEOS_KEYFILE")
 	flag.Parse()
 
 	if interval < 1*time.Second {
 		log.Fatalf("supplied sample interval (%v) too short", interval)
 	}
 
+	// remove the dataviews on SIGINT or SIGTERM, the deferred Close()
+	// calls below only run on a normal return
+	shutdown.Notify()
+
+	if keyfile != "" {
+		if err := xmlrpc.SetKeyFile(keyfile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// connect to netprobe
 	url := fmt.Sprintf("https://%s:%v/xmlrpc", hostname, port)
 	p, err := plugins.Sampler(url, entityname, samplername)
@@ -1,3 +1,3 @@
 module example
 
-go 1.14
+go 1.18
@@ -0,0 +1,61 @@
+package main
+
+// host runs the example samplers from a config file, see the host
+// package for the format, e.g.
+//
+//	host -c samplers.yaml
+//
+// send it a SIGHUP to apply changes to the file
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"wonderland.org/geneos/host"
+	"wonderland.org/geneos/plugins"
+	"wonderland.org/geneos/shutdown"
+
+	"example/cpu"
+	"example/generic"
+	"example/memory"
+	"example/process"
+)
+
+func init() {
+	host.Register("cpu", func(c plugins.Connection, name string, group string) (plugins.Plugins, error) {
+		return cpu.New(c, name, group)
+	})
+	host.Register("memory", func(c plugins.Connection, name string, group string) (plugins.Plugins, error) {
+		return memory.New(c, name, group)
+	})
+	host.Register("process", func(c plugins.Connection, name string, group string) (plugins.Plugins, error) {
+		return process.New(c, name, group)
+	})
+	host.Register("generic", func(c plugins.Connection, name string, group string) (plugins.Plugins, error) {
+		return generic.New(c, name, group)
+	})
+}
+
+func main() {
+	var config string
+	flag.StringVar(&config, "c", "samplers.yaml", "Config file, YAML or JSON")
+	flag.Parse()
+
+	shutdown.Notify()
+	c, err := host.Load(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	h := host.New(c)
+	if err = h.Start(); err != nil {
+		log.Fatal(err)
+	}
+	stop := h.ReloadOnSignal(config)
+
+	// the samplers are stopped and their dataviews removed by the
+	// shutdown package on SIGINT or SIGTERM, not by h.Close()
+	status := shutdown.Wait()
+	stop()
+	os.Exit(status)
+}
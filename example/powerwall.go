@@ -63,7 +63,8 @@ var pwrows = []string{
 }
 
 func (p *PowerwallSampler) InitSampler() (err error) {
-	pwurl, err := p.Parameter("POWERWALL_URL")
+	// the URL may hold credentials so can be encrypted in the setup
+	pwurl, err := p.ParameterString("POWERWALL_URL")
 	if err != nil {
 		return
 	}
@@ -72,7 +73,7 @@ func (p *PowerwallSampler) InitSampler() (err error) {
 	return
 }
 
-func (p PowerwallSampler) DoSample() (err error) {
+func (p *PowerwallSampler) DoSample() (err error) {
 	if p.pwurl == "" {
 		err = fmt.Errorf("No URL defined in sampler parameters (POWERWALL_URL)")
 		return
@@ -32,6 +32,6 @@ func (p *ProcessSampler) DoSample() (err error) {
 	return p.UpdateTableFromMap(data)
 }
 
-func (p ProcessSampler) initColumns() (cols samplers.Columns, columnnames []string, sortcol string, err error) {
+func (p *ProcessSampler) initColumns() (cols samplers.Columns, columnnames []string, sortcol string, err error) {
 	return p.ColumnInfo(Win32_Process{})
 }
@@ -1,3 +1,5 @@
 module wonderland.org/geneos
 
-go 1.14
+go 1.18
+
+require gopkg.in/yaml.v3 v3.0.1
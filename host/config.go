@@ -0,0 +1,238 @@
+package host // import "wonderland.org/geneos/host"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultInterval is the sample interval of samplers that don't set one
+const DefaultInterval = 1 * time.Second
+
+/*
+Config lists the Netprobes to connect to and the samplers to run on
+them. It is usually read from a file with Load(), e.g. in YAML:
+
+	keyFile: /opt/geneos/gateway/keyfile.aes
+	netprobes:
+	  - name: local
+	    url: https://localhost:7036/xmlrpc
+	    allowUnverifiedCertificates: true
+	samplers:
+	  - type: cpu
+	    entity: myhost
+	    sampler: cpu
+	    group: SYSTEM
+	    interval: 5s
+	  - type: process
+	    netprobe: local
+	    entity: myhost
+	    sampler: processes
+	    dataview: top
+	    interval: 10s
+	    parameters:
+	      ROW_LIMIT: "50"
+*/
+type Config struct {
+	// KeyFile is an optional Geneos key file to decrypt parameters, see
+	// xmlrpc.SetKeyFile()
+	KeyFile   string           `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	Netprobes []NetprobeConfig `json:"netprobes" yaml:"netprobes"`
+	Samplers  []SamplerConfig  `json:"samplers" yaml:"samplers"`
+}
+
+// NetprobeConfig is a Netprobe XML-RPC endpoint
+type NetprobeConfig struct {
+	// Name is used by samplers to refer to the Netprobe. It can be left
+	// empty if there is only one
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// URL is the XML-RPC endpoint, normally http[s]://host:port/xmlrpc
+	URL string `json:"url" yaml:"url"`
+
+	AllowUnverifiedCertificates bool `json:"allowUnverifiedCertificates,omitempty" yaml:"allowUnverifiedCertificates,omitempty"`
+	// CAFile is an optional PEM file of certificates to trust, in place
+	// of the system ones
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+}
+
+// SamplerConfig is one sampler instance
+type SamplerConfig struct {
+	// Type is the name the constructor was registered with
+	Type string `json:"type" yaml:"type"`
+	// Netprobe is the name of the Netprobe, which can be left empty if
+	// there is only one
+	Netprobe string `json:"netprobe,omitempty" yaml:"netprobe,omitempty"`
+	Entity   string `json:"entity" yaml:"entity"`
+	Sampler  string `json:"sampler" yaml:"sampler"`
+	// Dataview defaults to the sampler name
+	Dataview string   `json:"dataview,omitempty" yaml:"dataview,omitempty"`
+	Group    string   `json:"group,omitempty" yaml:"group,omitempty"`
+	Interval Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// Parameters are used in place of the sampler parameters of the same
+	// name in the Gateway setup
+	Parameters map[string]string `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+// Duration is a time.Duration that is read from a Go duration string,
+// e.g. "1m30s", or a number of seconds
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) (err error) {
+	var v interface{}
+	if err = json.Unmarshal(b, &v); err != nil {
+		return
+	}
+	switch t := v.(type) {
+	case float64:
+		*d = Duration(t * float64(time.Second))
+	case string:
+		return d.parse(t)
+	default:
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	return
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	return d.parse(value.Value)
+}
+
+func (d *Duration) parse(s string) error {
+	s = strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = Duration(f * float64(time.Second))
+		return nil
+	}
+	t, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(t)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Load reads a Config from a file, as YAML if the name ends .yaml or
+// .yml and JSON otherwise, and checks it with Validate(). Unknown
+// settings are an error so that typos are not silently ignored.
+func Load(path string) (config *Config, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	config = &Config{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(config)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err = config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return
+}
+
+// Validate checks that the Netprobes and sampler types exist and that
+// the required settings are present
+func (c *Config) Validate() error {
+	if len(c.Netprobes) == 0 {
+		return fmt.Errorf("no netprobes defined")
+	}
+	names := make(map[string]bool, len(c.Netprobes))
+	for i, n := range c.Netprobes {
+		if n.URL == "" {
+			return fmt.Errorf("netprobe %d: no url", i+1)
+		}
+		if names[n.Name] {
+			return fmt.Errorf("netprobe %q: defined more than once", n.Name)
+		}
+		names[n.Name] = true
+	}
+	seen := make(map[string]bool, len(c.Samplers))
+	for i, s := range c.Samplers {
+		if s.Type == "" || s.Entity == "" || s.Sampler == "" {
+			return fmt.Errorf("sampler %d: type, entity and sampler must be set", i+1)
+		}
+		if constructor(s.Type) == nil {
+			return fmt.Errorf("sampler %d: unknown type %q, registered types are %s",
+				i+1, s.Type, strings.Join(Types(), ", "))
+		}
+		if _, err := c.netprobe(s.Netprobe); err != nil {
+			return fmt.Errorf("sampler %d: %w", i+1, err)
+		}
+		if s.Interval < 0 {
+			return fmt.Errorf("sampler %d: negative interval", i+1)
+		}
+		id := s.id()
+		if seen[id] {
+			return fmt.Errorf("sampler %s: defined more than once", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// netprobe returns the named Netprobe. An empty name is allowed when
+// there is only one.
+func (c *Config) netprobe(name string) (n NetprobeConfig, err error) {
+	if name == "" && len(c.Netprobes) == 1 {
+		return c.Netprobes[0], nil
+	}
+	for _, n = range c.Netprobes {
+		if n.Name == name {
+			return
+		}
+	}
+	if name == "" {
+		err = fmt.Errorf("netprobe must be set when there is more than one")
+		return
+	}
+	err = fmt.Errorf("unknown netprobe %q", name)
+	return
+}
+
+// dataview returns the dataview name, defaulting to the sampler name
+func (s SamplerConfig) dataview() string {
+	if s.Dataview != "" {
+		return s.Dataview
+	}
+	return s.Sampler
+}
+
+// interval returns the sample interval, defaulting to DefaultInterval
+func (s SamplerConfig) interval() time.Duration {
+	if s.Interval == 0 {
+		return DefaultInterval
+	}
+	return time.Duration(s.Interval)
+}
+
+// id identifies a sampler instance, as [NETPROBE:]ENTITY/SAMPLER/[GROUP-]DATAVIEW
+func (s SamplerConfig) id() (id string) {
+	if s.Netprobe != "" {
+		id = s.Netprobe + ":"
+	}
+	id += s.Entity + "/" + s.Sampler + "/"
+	if s.Group != "" {
+		id += s.Group + "-"
+	}
+	return id + s.dataview()
+}
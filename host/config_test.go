@@ -0,0 +1,227 @@
+package host
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeConfig writes contents to a file called name in a temporary
+// directory
+func writeConfig(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const yamlConfig = `
+keyFile: /tmp/keyfile.aes
+netprobes:
+  - name: local
+    url: https://localhost:7036/xmlrpc
+    allowUnverifiedCertificates: true
+  - name: remote
+    url: http://remote:7036/xmlrpc
+samplers:
+  - type: stub
+    netprobe: local
+    entity: myhost
+    sampler: cpu
+    group: SYSTEM
+    interval: 1m30s
+  - type: stub
+    netprobe: remote
+    entity: myhost
+    sampler: processes
+    dataview: top
+    interval: 10
+    parameters:
+      ROW_LIMIT: "50"
+`
+
+const jsonConfig = `{
+  "keyFile": "/tmp/keyfile.aes",
+  "netprobes": [
+    {"name": "local", "url": "https://localhost:7036/xmlrpc", "allowUnverifiedCertificates": true},
+    {"name": "remote", "url": "http://remote:7036/xmlrpc"}
+  ],
+  "samplers": [
+    {"type": "stub", "netprobe": "local", "entity": "myhost", "sampler": "cpu", "group": "SYSTEM", "interval": "1m30s"},
+    {"type": "stub", "netprobe": "remote", "entity": "myhost", "sampler": "processes", "dataview": "top",
+     "interval": 10, "parameters": {"ROW_LIMIT": "50"}}
+  ]
+}`
+
+func TestLoad(t *testing.T) {
+	want := &Config{
+		KeyFile: "/tmp/keyfile.aes",
+		Netprobes: []NetprobeConfig{
+			{Name: "local", URL: "https://localhost:7036/xmlrpc", AllowUnverifiedCertificates: true},
+			{Name: "remote", URL: "http://remote:7036/xmlrpc"},
+		},
+		Samplers: []SamplerConfig{
+			{Type: "stub", Netprobe: "local", Entity: "myhost", Sampler: "cpu", Group: "SYSTEM",
+				Interval: Duration(90 * time.Second)},
+			{Type: "stub", Netprobe: "remote", Entity: "myhost", Sampler: "processes", Dataview: "top",
+				Interval: Duration(10 * time.Second), Parameters: map[string]string{"ROW_LIMIT": "50"}},
+		},
+	}
+	tests := []struct {
+		file     string
+		contents string
+		wantErr  string
+	}{
+		{"config.yaml", yamlConfig, ""},
+		{"config.YML", yamlConfig, ""},
+		{"config.json", jsonConfig, ""},
+		// anything that isn't YAML is read as JSON
+		{"config", jsonConfig, ""},
+		{"config.conf", yamlConfig, "invalid character"},
+		{"typo.yaml", strings.Replace(yamlConfig, "dataview:", "dataveiw:", 1), "dataveiw"},
+		{"typo.json", strings.Replace(jsonConfig, `"dataview"`, `"dataveiw"`, 1), "dataveiw"},
+		{"duration.yaml", strings.Replace(yamlConfig, "1m30s", "soon", 1), "soon"},
+		{"duration.json", strings.Replace(jsonConfig, `"1m30s"`, "true", 1), "invalid duration"},
+		{"invalid.yaml", strings.Replace(yamlConfig, "type: stub", "type: nope", 1), `unknown type "nope"`},
+		{"invalid.json", `{"samplers": []}`, "no netprobes defined"},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, tt.file, tt.contents)
+		config, err := Load(path)
+		if tt.wantErr != "" {
+			// errors name the file
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.HasPrefix(err.Error(), path) {
+				t.Errorf("%s: Load() error %v, want %q", tt.file, err, tt.wantErr)
+			}
+			if config != nil {
+				t.Errorf("%s: Load() returned a config with an error", tt.file)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if !reflect.DeepEqual(config, want) {
+			t.Errorf("%s: Load() = %+v, want %+v", tt.file, config, want)
+		}
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file: no error")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		json    string
+		yaml    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{`"1m30s"`, "1m30s", 90 * time.Second, false},
+		{`"250ms"`, "250ms", 250 * time.Millisecond, false},
+		{`" 2h "`, `" 2h "`, 2 * time.Hour, false},
+		{`5`, "5", 5 * time.Second, false},
+		{`0.5`, "0.5", 500 * time.Millisecond, false},
+		{`"5"`, `"5"`, 5 * time.Second, false},
+		{`0`, "0", 0, false},
+		{`"-1s"`, "-1s", -time.Second, false},
+		{`"5 minutes"`, "5 minutes", 0, true},
+		{`""`, `""`, 0, true},
+		{`true`, "", 0, true},
+		{`[1]`, "[1]", 0, true},
+	}
+	for _, tt := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(tt.json), &d)
+		if (err != nil) != tt.wantErr || (err == nil && time.Duration(d) != tt.want) {
+			t.Errorf("JSON %s = %v, %v, want %v", tt.json, d, err, tt.want)
+		}
+		if tt.yaml == "" {
+			continue
+		}
+		d = 0
+		err = yaml.Unmarshal([]byte(tt.yaml), &d)
+		if (err != nil) != tt.wantErr || (err == nil && time.Duration(d) != tt.want) {
+			t.Errorf("YAML %s = %v, %v, want %v", tt.yaml, d, err, tt.want)
+		}
+	}
+	if s := Duration(90 * time.Second).String(); s != "1m30s" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	local := NetprobeConfig{Name: "local", URL: "http://localhost:7036/xmlrpc"}
+	remote := NetprobeConfig{Name: "remote", URL: "http://remote:7036/xmlrpc"}
+	cpu := SamplerConfig{Type: "stub", Entity: "e", Sampler: "cpu"}
+	with := func(s SamplerConfig, change func(*SamplerConfig)) SamplerConfig {
+		change(&s)
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		netprobes []NetprobeConfig
+		samplers  []SamplerConfig
+		wantErr   string
+	}{
+		{"one netprobe", []NetprobeConfig{local}, []SamplerConfig{cpu}, ""},
+		{"no samplers", []NetprobeConfig{local}, nil, ""},
+		{"named netprobe", []NetprobeConfig{local, remote},
+			[]SamplerConfig{with(cpu, func(s *SamplerConfig) { s.Netprobe = "remote" })}, ""},
+		{"same sampler, other dataview", []NetprobeConfig{local},
+			[]SamplerConfig{cpu, with(cpu, func(s *SamplerConfig) { s.Dataview = "other" })}, ""},
+		{"same sampler, other group", []NetprobeConfig{local},
+			[]SamplerConfig{cpu, with(cpu, func(s *SamplerConfig) { s.Group = "SYSTEM" })}, ""},
+		{"same sampler, other netprobe", []NetprobeConfig{local, remote}, []SamplerConfig{
+			with(cpu, func(s *SamplerConfig) { s.Netprobe = "local" }),
+			with(cpu, func(s *SamplerConfig) { s.Netprobe = "remote" }),
+		}, ""},
+
+		{"no netprobes", nil, []SamplerConfig{cpu}, "no netprobes defined"},
+		{"no url", []NetprobeConfig{{Name: "local"}}, nil, "netprobe 1: no url"},
+		{"duplicate netprobe", []NetprobeConfig{local, local}, nil, `netprobe "local": defined more than once`},
+		{"no type", []NetprobeConfig{local},
+			[]SamplerConfig{with(cpu, func(s *SamplerConfig) { s.Type = "" })}, "type, entity and sampler must be set"},
+		{"no entity", []NetprobeConfig{local},
+			[]SamplerConfig{with(cpu, func(s *SamplerConfig) { s.Entity = "" })}, "type, entity and sampler must be set"},
+		{"no sampler", []NetprobeConfig{local},
+			[]SamplerConfig{cpu, with(cpu, func(s *SamplerConfig) { s.Sampler = "" })}, "sampler 2: type, entity and sampler"},
+		{"unknown type", []NetprobeConfig{local},
+			[]SamplerConfig{with(cpu, func(s *SamplerConfig) { s.Type = "nope" })}, `unknown type "nope", registered types are`},
+		{"unknown netprobe", []NetprobeConfig{local},
+			[]SamplerConfig{with(cpu, func(s *SamplerConfig) { s.Netprobe = "nope" })}, `unknown netprobe "nope"`},
+		{"netprobe needed", []NetprobeConfig{local, remote}, []SamplerConfig{cpu},
+			"netprobe must be set when there is more than one"},
+		{"negative interval", []NetprobeConfig{local},
+			[]SamplerConfig{with(cpu, func(s *SamplerConfig) { s.Interval = Duration(-time.Second) })}, "negative interval"},
+		{"duplicate sampler", []NetprobeConfig{local}, []SamplerConfig{cpu, cpu},
+			"sampler e/cpu/cpu: defined more than once"},
+		// the dataview defaults to the sampler name
+		{"duplicate dataview", []NetprobeConfig{local},
+			[]SamplerConfig{cpu, with(cpu, func(s *SamplerConfig) { s.Dataview = "cpu"; s.Interval = Duration(time.Minute) })},
+			"sampler e/cpu/cpu: defined more than once"},
+	}
+	for _, tt := range tests {
+		c := &Config{Netprobes: tt.netprobes, Samplers: tt.samplers}
+		err := c.Validate()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Validate() error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
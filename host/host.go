@@ -0,0 +1,254 @@
+/*
+Package host runs a set of samplers described by a Config, rather than
+each program creating and starting them by hand in main().
+
+Sampler types are registered by name with their constructor, which has
+the same signature as the New() functions of the samplers, and a Host
+creates one of each configured instance:
+
+	host.Register("cpu", func(c plugins.Connection, name, group string) (plugins.Plugins, error) {
+		return cpu.New(c, name, group)
+	})
+
+	config, err := host.Load("samplers.yaml")
+	...
+	h := host.New(config)
+	if err = h.Start(); err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		<-quit
+		h.Close()
+	}()
+	h.Wait()
+*/
+package host // import "wonderland.org/geneos/host"
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"wonderland.org/geneos"
+	"wonderland.org/geneos/plugins"
+	"wonderland.org/geneos/streams"
+	"wonderland.org/geneos/xmlrpc"
+)
+
+var (
+	Logger      = geneos.Logger
+	DebugLogger = geneos.DebugLogger
+	ErrorLogger = geneos.ErrorLogger
+)
+
+// Constructor creates a sampler instance with a dataview called name in
+// group on the connection
+type Constructor func(c plugins.Connection, name string, group string) (plugins.Plugins, error)
+
+var errClosed = errors.New("host is closed")
+
+var registry = struct {
+	sync.Mutex
+	constructors map[string]Constructor
+}{constructors: make(map[string]Constructor)}
+
+// Register adds a sampler type. Registering a name again replaces the
+// constructor.
+func Register(name string, c Constructor) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.constructors[name] = c
+}
+
+// Types returns the registered sampler types, sorted
+func Types() (types []string) {
+	registry.Lock()
+	defer registry.Unlock()
+	for name := range registry.constructors {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return
+}
+
+func constructor(name string) Constructor {
+	registry.Lock()
+	defer registry.Unlock()
+	return registry.constructors[name]
+}
+
+// Host runs the samplers of a Config
+type Host struct {
+	mu        sync.Mutex
+	config    *Config
+	instances []*instance
+	stream    *streams.Stream
+	wg        sync.WaitGroup
+	done      chan struct{} // closed by Close()
+}
+
+// instance is a running sampler and the settings it was started with,
+// which are compared on Reload()
+type instance struct {
+	config   SamplerConfig
+	netprobe NetprobeConfig
+	plugin   plugins.Plugins
+}
+
+// New returns a Host for config. Nothing is started until Start()
+func New(config *Config) *Host {
+	return &Host{config: config, done: make(chan struct{})}
+}
+
+// SetStream sets an optional stream that reload reports are written
+// to, as well as the log. The stream name must already have been set
+// using SetStreamName()
+func (h *Host) SetStream(stream *streams.Stream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stream = stream
+}
+
+// Start creates and starts every sampler in the Config. If one fails
+// those already started are closed and the error returned.
+func (h *Host) Start() (err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed() {
+		return errClosed
+	}
+	if err = h.config.Validate(); err != nil {
+		return
+	}
+	if h.config.KeyFile != "" {
+		if err = xmlrpc.SetKeyFile(h.config.KeyFile); err != nil {
+			return
+		}
+	}
+	for _, s := range h.config.Samplers {
+		var i *instance
+		if i, err = h.start(h.config, s); err != nil {
+			h.closeAll()
+			return
+		}
+		h.instances = append(h.instances, i)
+	}
+	return
+}
+
+func (h *Host) start(config *Config, s SamplerConfig) (i *instance, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("sampler %s: %w", s.id(), err)
+		}
+	}()
+	n, err := config.netprobe(s.Netprobe)
+	if err != nil {
+		return
+	}
+	c, err := connect(n, s)
+	if err != nil {
+		return
+	}
+	p, err := constructor(s.Type)(c, s.dataview(), s.Group)
+	if err != nil {
+		return
+	}
+	p.SetInterval(s.interval())
+	if err = p.Start(&h.wg); err != nil {
+		p.Close()
+		return
+	}
+	Logger.Printf("started %s sampler %s", s.Type, s.id())
+	return &instance{config: s, netprobe: n, plugin: p}, nil
+}
+
+// stop stops a sampler, if it can be, and closes its dataviews
+func (i *instance) stop() error {
+	if s, ok := i.plugin.(interface{ Stop() }); ok {
+		s.Stop()
+	}
+	return i.plugin.Close()
+}
+
+// connect returns a connection to the sampler s on the Netprobe n with
+// the TLS settings of n and the local parameters of s
+func connect(n NetprobeConfig, s SamplerConfig) (c plugins.Connection, err error) {
+	if c, err = plugins.Sampler(n.URL, s.Entity, s.Sampler); err != nil {
+		return
+	}
+	switch {
+	case n.CAFile != "":
+		var pem []byte
+		if pem, err = os.ReadFile(n.CAFile); err != nil {
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("no certificates found in %q", n.CAFile)
+			return
+		}
+		c.SetTLSConfig(&tls.Config{RootCAs: pool, InsecureSkipVerify: n.AllowUnverifiedCertificates})
+	case n.AllowUnverifiedCertificates:
+		c.AllowUnverifiedCertificates()
+	}
+	if len(s.Parameters) > 0 {
+		c.Sampler = c.Sampler.WithParameters(s.Parameters)
+	}
+	return
+}
+
+// Samplers returns the running samplers in the order of the Config
+func (h *Host) Samplers() (samplers []plugins.Plugins) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, i := range h.instances {
+		samplers = append(samplers, i.plugin)
+	}
+	return
+}
+
+// Wait blocks until Close() has been called and all the samplers have
+// exited. Samplers exiting by themselves, or all being replaced by
+// Reload(), do not end the wait.
+func (h *Host) Wait() {
+	<-h.done
+	h.wg.Wait()
+}
+
+// Close stops all the samplers, removing their dataviews, and returns
+// the first error, if any. The Host cannot be started again.
+func (h *Host) Close() (err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed() {
+		return
+	}
+	err = h.closeAll()
+	close(h.done)
+	return
+}
+
+// closed returns true once Close() has been called. The caller holds h.mu
+func (h *Host) closed() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (h *Host) closeAll() (err error) {
+	for _, i := range h.instances {
+		if e := i.stop(); e != nil && err == nil {
+			err = e
+		}
+	}
+	h.instances = nil
+	return
+}
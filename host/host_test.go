@@ -0,0 +1,130 @@
+package host
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/plugins"
+)
+
+// stubs tracks the running stub samplers by dataview
+var stubs = struct {
+	sync.Mutex
+	running map[string]int
+	most    int // the most instances seen on one dataview
+}{running: make(map[string]int)}
+
+// stub is a sampler that runs until stopped
+type stub struct {
+	name     string
+	interval time.Duration
+	stop     chan struct{}
+}
+
+func (s *stub) SetInterval(interval time.Duration) { s.interval = interval }
+func (s *stub) Interval() time.Duration            { return s.interval }
+
+func (s *stub) Start(wg *sync.WaitGroup) error {
+	stubs.Lock()
+	stubs.running[s.name]++
+	if stubs.running[s.name] > stubs.most {
+		stubs.most = stubs.running[s.name]
+	}
+	stubs.Unlock()
+	s.stop = make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-s.stop
+	}()
+	return nil
+}
+
+func (s *stub) Stop() {
+	stubs.Lock()
+	defer stubs.Unlock()
+	stubs.running[s.name]--
+	close(s.stop)
+}
+
+func (s *stub) Close() error { return nil }
+
+func init() {
+	Register("stub", func(c plugins.Connection, name string, group string) (plugins.Plugins, error) {
+		return &stub{name: name}, nil
+	})
+}
+
+func stubConfig(samplers ...SamplerConfig) *Config {
+	return &Config{Netprobes: []NetprobeConfig{{URL: "http://localhost:7036/xmlrpc"}}, Samplers: samplers}
+}
+
+func TestReload(t *testing.T) {
+	a := SamplerConfig{Type: "stub", Entity: "e", Sampler: "a"}
+	b := SamplerConfig{Type: "stub", Entity: "e", Sampler: "b"}
+	c := SamplerConfig{Type: "stub", Entity: "e", Sampler: "c"}
+	a2, b2 := a, b
+	a2.Interval, b2.Interval = Duration(5*time.Second), Duration(5*time.Second)
+
+	tests := []struct {
+		name    string
+		config  *Config
+		want    ReloadReport
+		wantErr bool
+	}{
+		{"unchanged", stubConfig(a, b), ReloadReport{Unchanged: 2}, false},
+		{"every sampler changed", stubConfig(a2, b2), ReloadReport{Restarted: []string{"e/a/a", "e/b/b"}}, false},
+		{"add and remove", stubConfig(b2, c), ReloadReport{Started: []string{"e/c/c"}, Stopped: []string{"e/a/a"}, Unchanged: 1}, false},
+		{"every sampler replaced", stubConfig(a), ReloadReport{Started: []string{"e/a/a"}, Stopped: []string{"e/b/b", "e/c/c"}}, false},
+		{"invalid", stubConfig(SamplerConfig{Type: "nope", Entity: "e", Sampler: "x"}), ReloadReport{}, true},
+	}
+
+	h := New(stubConfig(a, b))
+	if err := h.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waited := make(chan struct{})
+	go func() {
+		h.Wait()
+		close(waited)
+	}()
+	for _, tt := range tests {
+		report, err := h.Reload(tt.config)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Reload() error %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(report, tt.want) {
+			t.Errorf("%s: report %+v, want %+v", tt.name, report, tt.want)
+		}
+		select {
+		case <-waited:
+			t.Fatalf("%s: Wait() returned before Close()", tt.name)
+		default:
+		}
+	}
+	if len(h.Samplers()) != 1 {
+		t.Errorf("%d samplers running, want 1", len(h.Samplers()))
+	}
+	stubs.Lock()
+	if stubs.most > 1 {
+		t.Errorf("%d instances on one dataview at once", stubs.most)
+	}
+	stubs.Unlock()
+
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() did not return after Close()")
+	}
+	if err := h.Close(); err != nil {
+		t.Errorf("second Close() = %v", err)
+	}
+	if _, err := h.Reload(stubConfig(a)); err == nil {
+		t.Error("Reload() after Close(): no error")
+	}
+}
@@ -0,0 +1,171 @@
+package host // import "wonderland.org/geneos/host"
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"wonderland.org/geneos/xmlrpc"
+)
+
+// ReloadReport is the outcome of a Reload(), listing the samplers as
+// [NETPROBE:]ENTITY/SAMPLER/[GROUP-]DATAVIEW
+type ReloadReport struct {
+	Started   []string
+	Stopped   []string
+	Restarted []string
+	Unchanged int
+	Errors    []error
+}
+
+func (r ReloadReport) String() string {
+	var parts []string
+	if len(r.Started) > 0 {
+		parts = append(parts, "started "+strings.Join(r.Started, ", "))
+	}
+	if len(r.Stopped) > 0 {
+		parts = append(parts, "stopped "+strings.Join(r.Stopped, ", "))
+	}
+	if len(r.Restarted) > 0 {
+		parts = append(parts, "restarted "+strings.Join(r.Restarted, ", "))
+	}
+	parts = append(parts, fmt.Sprintf("%d unchanged", r.Unchanged))
+	for _, err := range r.Errors {
+		parts = append(parts, "error: "+err.Error())
+	}
+	return "reload: " + strings.Join(parts, "; ")
+}
+
+/*
+Reload applies config to the running samplers. Samplers are matched on
+their netprobe, entity, sampler, group and dataview names:
+
+  - new samplers are started
+  - samplers whose settings, or those of their Netprobe, have changed
+    are stopped and started again
+  - samplers no longer in config are stopped, after the others have
+    started, and their dataviews removed
+  - all others are left running, with their dataviews untouched
+
+An invalid config is rejected and nothing changes. Otherwise samplers
+that fail to start are listed in the report errors, and the first is
+returned, while the rest of the reload goes ahead. The report is written
+to the log and to the stream set by SetStream(), if any.
+*/
+func (h *Host) Reload(config *Config) (report ReloadReport, err error) {
+	if err = config.Validate(); err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed() {
+		err = errClosed
+		return
+	}
+
+	if config.KeyFile != "" && config.KeyFile != h.config.KeyFile {
+		if err = xmlrpc.SetKeyFile(config.KeyFile); err != nil {
+			return
+		}
+	}
+
+	running := make(map[string]*instance, len(h.instances))
+	for _, i := range h.instances {
+		running[i.config.id()] = i
+	}
+
+	// build the new list in config order, starting new samplers before
+	// any are stopped. A changed sampler keeps its dataviews so it has to
+	// stop just before its replacement starts
+	var instances []*instance
+	for _, s := range config.Samplers {
+		id := s.id()
+		old, ok := running[id]
+		if ok {
+			delete(running, id)
+			n, _ := config.netprobe(s.Netprobe)
+			if reflect.DeepEqual(s, old.config) && n == old.netprobe {
+				instances = append(instances, old)
+				report.Unchanged++
+				continue
+			}
+			if e := old.stop(); e != nil {
+				report.Errors = append(report.Errors, fmt.Errorf("sampler %s: %w", id, e))
+			}
+		}
+		i, e := h.start(config, s)
+		if e != nil {
+			report.Errors = append(report.Errors, e)
+			continue
+		}
+		instances = append(instances, i)
+		if ok {
+			report.Restarted = append(report.Restarted, id)
+		} else {
+			report.Started = append(report.Started, id)
+		}
+	}
+
+	// then stop the samplers no longer in config, in their old order
+	for _, i := range h.instances {
+		id := i.config.id()
+		if _, ok := running[id]; !ok {
+			continue
+		}
+		report.Stopped = append(report.Stopped, id)
+		if e := i.stop(); e != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("sampler %s: %w", id, e))
+		}
+	}
+	h.instances, h.config = instances, config
+
+	if len(report.Errors) > 0 {
+		err = report.Errors[0]
+	}
+	h.report(report.String())
+	return
+}
+
+// report writes a message to the log and the stream, if set
+func (h *Host) report(msg string) {
+	Logger.Print(msg)
+	if h.stream != nil {
+		if _, err := h.stream.WriteString(msg); err != nil {
+			ErrorLogger.Print(err)
+		}
+	}
+}
+
+// ReloadOnSignal loads the config file at path and applies it with
+// Reload() each time the process gets a SIGHUP. A file that fails to
+// load is reported and the running samplers are left alone. Call the
+// returned function to stop watching for the signal.
+func (h *Host) ReloadOnSignal(path string) (stop func()) {
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-c:
+			case <-done:
+				return
+			}
+			config, err := Load(path)
+			if err != nil {
+				h.mu.Lock()
+				h.report(fmt.Sprintf("reload: %v", err))
+				h.mu.Unlock()
+				continue
+			}
+			h.Reload(config)
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"wonderland.org/geneos"
+	"wonderland.org/geneos/shutdown"
 	"wonderland.org/geneos/xmlrpc"
 )
 
@@ -34,3 +35,29 @@ func Sampler(url string, entityName string, samplerName string) (s Connection, e
 	s = Connection{sampler}
 	return
 }
+
+// signOnKey identifies a sign on registered for shutdown
+type signOnKey struct {
+	url, entity, sampler string
+}
+
+// SignOn signs on to the sampler with the interval given and registers
+// with the shutdown package so that it is signed off if the process is
+// stopped
+func (c *Connection) SignOn(interval time.Duration) (err error) {
+	if err = c.Sampler.SignOn(interval); err != nil {
+		return
+	}
+	s := c.Sampler
+	shutdown.Register(signOnKey{s.URL(), s.EntityName(), s.SamplerName()}, shutdown.Hook{
+		Name:     "sign on " + s.ToString(),
+		Teardown: s.SignOff,
+	})
+	return
+}
+
+// SignOff cancels the heartbeat requirement set by SignOn()
+func (c *Connection) SignOff() error {
+	shutdown.Unregister(signOnKey{c.URL(), c.EntityName(), c.SamplerName()})
+	return c.Sampler.SignOff()
+}
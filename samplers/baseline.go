@@ -0,0 +1,264 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// baselineVersion is the version of the baseline file format
+const baselineVersion = 1
+
+// bootIDFile holds a value that changes on every boot, on Linux. On
+// other systems only the age of a saved baseline is checked.
+var bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+/*
+Baseline holds the previous sample of a delta sampler, the olddata of
+UpdateTableFromMapDelta(), and when it was taken. With a file path it is
+also saved after each Update() and read back the first time Previous()
+is called, so a restarted sampler can publish deltas from its first
+sample instead of waiting for a second one.
+
+A saved baseline is ignored, and the file removed, if it is stale:
+
+  - it was saved before the system was rebooted, as counters start
+    again from zero
+  - it is older than maxAge, if not zero
+  - it is from the future, as the clock has gone backwards
+  - it was saved for a different type or can't be read
+
+Persisted data is stored as JSON so T must survive a round trip, e.g. a
+map of structs with exported fields. The path must be unique to the
+sampler, including its Netprobe and entity:
+
+	p.baseline = samplers.NewBaseline[map[string]CPUStats](path, 3*p.Interval())
+	...
+	stats, now := readStats()
+	err = p.baseline.UpdateTable(p.View, stats, now)
+
+UpdateTable() does the same as:
+
+	if last, when, ok := p.baseline.Previous(); ok {
+		err = p.UpdateTableFromMapDelta(stats, last, now.Sub(when))
+	}
+	if e := p.baseline.Update(stats, now); e != nil && err == nil {
+		err = e
+	}
+*/
+type Baseline[T any] struct {
+	mu     sync.Mutex
+	path   string
+	maxage time.Duration
+	clock  Clock
+
+	loaded bool
+	valid  bool
+	data   T
+	when   time.Time
+}
+
+// baselineFile is the on-disk format of a Baseline
+type baselineFile struct {
+	Version int             `json:"version"`
+	Type    string          `json:"type"`
+	BootID  string          `json:"bootID,omitempty"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewBaseline returns an empty Baseline saved to path, or kept only in
+// memory if path is empty. Saved baselines older than maxAge are not
+// used, a zero maxAge turns off the age check.
+func NewBaseline[T any](path string, maxAge time.Duration) *Baseline[T] {
+	return &Baseline[T]{path: path, maxage: maxAge}
+}
+
+// SetClock sets the Clock used to check the age of a saved baseline,
+// for tests. The default is SystemClock.
+func (b *Baseline[T]) SetClock(clock Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clock = clock
+}
+
+// Previous returns the previous sample and when it was taken. ok is
+// false if there isn't one, e.g. on the first sample with no usable
+// saved baseline.
+func (b *Baseline[T]) Previous() (data T, when time.Time, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.loaded {
+		b.loaded = true
+		if err := b.load(); err != nil {
+			ErrorLogger.Printf("baseline %s: %v", b.path, err)
+		}
+	}
+	if !b.valid {
+		return
+	}
+	return b.data, b.when, true
+}
+
+// Update makes data, taken at when, the previous sample and saves it if
+// the Baseline has a path. The sample is kept even if saving fails.
+func (b *Baseline[T]) Update(data T, when time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// a saved baseline is only useful before the first update
+	b.loaded = true
+	b.data, b.when, b.valid = data, when, true
+	if b.path == "" {
+		return nil
+	}
+	return b.save()
+}
+
+// UpdateTable publishes the difference between data and the previous
+// sample, if there is one, to v using UpdateTableFromMapDelta() and then
+// makes data the previous sample. T must be a map. An error publishing
+// the table is returned before one saving the baseline, which is then
+// logged.
+func (b *Baseline[T]) UpdateTable(v *View, data T, when time.Time) (err error) {
+	if last, prev, ok := b.Previous(); ok {
+		err = v.UpdateTableFromMapDelta(data, last, when.Sub(prev))
+	}
+	if e := b.Update(data, when); e != nil {
+		if err == nil {
+			return e
+		}
+		ErrorLogger.Printf("baseline %s: %v", b.path, e)
+	}
+	return
+}
+
+// Reset forgets the previous sample and removes the saved copy, e.g.
+// after the source of the counters has been restarted
+func (b *Baseline[T]) Reset() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var zero T
+	b.loaded = true
+	b.data, b.when, b.valid = zero, time.Time{}, false
+	return b.remove()
+}
+
+func (b *Baseline[T]) timeSource() Clock {
+	if b.clock == nil {
+		return SystemClock
+	}
+	return b.clock
+}
+
+// typeName identifies T in the baseline file
+func (b *Baseline[T]) typeName() string {
+	return reflect.TypeOf((*T)(nil)).Elem().String()
+}
+
+// load reads the saved baseline, if any, and removes it if it is stale.
+// A missing file is not an error. The caller holds b.mu.
+func (b *Baseline[T]) load() (err error) {
+	if b.path == "" {
+		return
+	}
+	f, err := os.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	var saved baselineFile
+	var data T
+	if err = json.Unmarshal(f, &saved); err == nil {
+		if err = b.stale(saved); err == nil {
+			err = json.Unmarshal(saved.Data, &data)
+		}
+	}
+	if err != nil {
+		b.remove()
+		return fmt.Errorf("ignored: %w", err)
+	}
+	b.data, b.when, b.valid = data, saved.Time, true
+	Logger.Printf("baseline %s: restored sample from %v", b.path, saved.Time)
+	return
+}
+
+// stale returns an error describing why a saved baseline can't be used
+func (b *Baseline[T]) stale(saved baselineFile) error {
+	now := b.timeSource().Now()
+	switch {
+	case saved.Version != baselineVersion:
+		return fmt.Errorf("version %d, not %d", saved.Version, baselineVersion)
+	case saved.Type != b.typeName():
+		return fmt.Errorf("saved for %s, not %s", saved.Type, b.typeName())
+	case saved.BootID != bootID():
+		return fmt.Errorf("saved before the system was restarted")
+	case saved.Time.After(now):
+		return fmt.Errorf("saved in the future, at %v", saved.Time)
+	case b.maxage > 0 && now.Sub(saved.Time) > b.maxage:
+		return fmt.Errorf("saved %v ago, more than %v", now.Sub(saved.Time).Round(time.Second), b.maxage)
+	}
+	return nil
+}
+
+// save writes the baseline to a temporary file and renames it into
+// place so a crash never leaves a partial file. The caller holds b.mu.
+func (b *Baseline[T]) save() (err error) {
+	data, err := json.Marshal(b.data)
+	if err != nil {
+		return
+	}
+	out, err := json.Marshal(baselineFile{
+		Version: baselineVersion,
+		Type:    b.typeName(),
+		BootID:  bootID(),
+		Time:    b.when,
+		Data:    data,
+	})
+	if err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".*")
+	if err != nil {
+		return
+	}
+	if _, err = tmp.Write(out); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), b.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return
+}
+
+// remove deletes the saved baseline, if any. The caller holds b.mu.
+func (b *Baseline[T]) remove() error {
+	if b.path == "" {
+		return nil
+	}
+	if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// bootID returns an identifier of the current boot of the system, or an
+// empty string if there isn't one
+func bootID() string {
+	id, err := os.ReadFile(bootIDFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(id))
+}
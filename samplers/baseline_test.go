@@ -0,0 +1,117 @@
+package samplers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type baselineStats struct {
+	Name  string
+	Count uint64
+}
+
+func TestBaseline(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "baseline.json")
+	bootIDFile = filepath.Join(dir, "boot_id")
+	defer func(file string) { bootIDFile = file }(bootIDFile)
+	boot := func(id string) {
+		if err := os.WriteFile(bootIDFile, []byte(id+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sample := map[string]baselineStats{"a": {"a", 5}}
+	clock := NewFakeClock(time.Time{})
+
+	tests := []struct {
+		name    string
+		saved   time.Duration // when the sample was saved, from now
+		advance time.Duration
+		reboot  bool
+		load    func() (ok bool)
+		want    bool
+	}{
+		{"fresh", 0, 30 * time.Second, false, nil, true},
+		{"too old", 0, 2 * time.Minute, false, nil, false},
+		{"from the future", time.Hour, 0, false, nil, false},
+		{"rebooted", 0, time.Second, true, nil, false},
+		{"no age check", -24 * time.Hour, 0, false, func() bool {
+			_, _, ok := NewBaseline[map[string]baselineStats](path, 0).Previous()
+			return ok
+		}, true},
+		{"different type", 0, 0, false, func() bool {
+			_, _, ok := NewBaseline[[]int](path, 0).Previous()
+			return ok
+		}, false},
+	}
+	for _, tt := range tests {
+		boot("first")
+		saver := NewBaseline[map[string]baselineStats](path, time.Minute)
+		if err := saver.Update(sample, clock.Now().Add(tt.saved)); err != nil {
+			t.Fatalf("%s: Update() = %v", tt.name, err)
+		}
+		clock.Advance(tt.advance)
+		if tt.reboot {
+			boot("second")
+		}
+		var ok bool
+		if tt.load != nil {
+			ok = tt.load()
+		} else {
+			b := NewBaseline[map[string]baselineStats](path, time.Minute)
+			b.SetClock(clock)
+			var data map[string]baselineStats
+			var when time.Time
+			data, when, ok = b.Previous()
+			if ok && (!reflect.DeepEqual(data, sample) || !when.Equal(clock.Now().Add(tt.saved-tt.advance))) {
+				t.Errorf("%s: Previous() = %v, %v", tt.name, data, when)
+			}
+		}
+		if ok != tt.want {
+			t.Errorf("%s: Previous() ok = %v, want %v", tt.name, ok, tt.want)
+		}
+		// a stale baseline is removed
+		if _, err := os.Stat(path); os.IsNotExist(err) == tt.want {
+			t.Errorf("%s: saved file exists %v, want %v", tt.name, !os.IsNotExist(err), tt.want)
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) > 2 {
+			t.Errorf("%s: temporary files left behind: %d entries", tt.name, len(entries))
+		}
+	}
+
+	// an update replaces a saved baseline that hasn't been read
+	b := NewBaseline[map[string]baselineStats](path, 0)
+	b.Update(map[string]baselineStats{}, clock.Now())
+	if data, _, ok := b.Previous(); !ok || len(data) != 0 {
+		t.Errorf("Previous() after Update() = %v, %v", data, ok)
+	}
+	if err := b.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := b.Previous(); ok {
+		t.Error("Previous() after Reset() = ok")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Reset() did not remove the saved file")
+	}
+
+	// a failed save is reported but the sample is kept
+	unsaved := NewBaseline[int](filepath.Join(dir, "missing", "baseline.json"), 0)
+	if err := unsaved.Update(1, clock.Now()); err == nil {
+		t.Error("Update() to a missing directory: no error")
+	}
+	if data, _, ok := unsaved.Previous(); !ok || data != 1 {
+		t.Errorf("Previous() after a failed save = %v, %v", data, ok)
+	}
+	memory := NewBaseline[int]("", 0)
+	if err := memory.Update(2, clock.Now()); err != nil {
+		t.Error(err)
+	}
+	if data, _, ok := memory.Previous(); !ok || data != 2 {
+		t.Errorf("Previous() without a path = %v, %v", data, ok)
+	}
+}
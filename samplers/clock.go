@@ -0,0 +1,259 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+Clock is the source of time used by samplers and views: the sample
+schedule, restart backoff, parameter refresh, row grace and expiry
+periods and "age" time columns. The default is SystemClock. Tests can
+use a FakeClock instead, set with SetClock(), and move time on with
+Advance() rather than sleeping.
+*/
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+	NewTimer(d time.Duration) Timer
+}
+
+// Ticker is the part of time.Ticker used by samplers
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// Timer is the part of time.Timer used by samplers
+type Timer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// SystemClock is the real time, using the time package
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTicker struct{ *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+type systemTimer struct{ *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+/*
+FakeClock is a Clock that only moves when told to. Tickers and timers
+fire, in order, as Advance() or Set() passes their deadlines. Like the
+real ones their channels hold one value and a ticker drops ticks that
+are not read in time.
+
+As the sampler goroutine creates its ticker after Start() returns, use
+BlockUntil() before the first Advance():
+
+	clock := samplers.NewFakeClock(time.Time{})
+	p.SetClock(clock)
+	p.Start(&wg)
+	clock.BlockUntil(1)
+	clock.Advance(p.Interval()) // DoSample() is called
+*/
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending ticker or timer
+type fakeWaiter struct {
+	clock  *FakeClock
+	c      chan time.Time
+	when   time.Time
+	period time.Duration // zero for a timer
+}
+
+// NewFakeClock returns a FakeClock set to now. A zero now is replaced
+// by a fixed, arbitrary, time so that tests don't depend on the date.
+func NewFakeClock(now time.Time) *FakeClock {
+	if now.IsZero() {
+		now = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	f := &FakeClock{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *FakeClock) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("samplers: non-positive interval for FakeClock.NewTicker")
+	}
+	return fakeTicker{f.add(d, d)}
+}
+
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	return f.add(d, 0)
+}
+
+// add schedules a waiter and fires it straight away if it is already due
+func (f *FakeClock) add(d time.Duration, period time.Duration) *fakeWaiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1), period: period}
+	w.schedule(d)
+	f.fire()
+	return w
+}
+
+// Advance moves the clock on by d, firing any tickers and timers that
+// fall due on the way
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanceTo(f.now.Add(d))
+}
+
+// Set moves the clock to t, firing any tickers and timers that fall due
+// on the way. The clock never goes backwards.
+func (f *FakeClock) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanceTo(t)
+}
+
+// Waiters returns the number of active tickers and timers
+func (f *FakeClock) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until there are at least n active tickers and timers
+func (f *FakeClock) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// advanceTo moves now to t one deadline at a time so that each waiter
+// sees the time it was due. The caller holds f.mu.
+func (f *FakeClock) advanceTo(t time.Time) {
+	for len(f.waiters) > 0 && !f.waiters[0].when.After(t) {
+		if f.waiters[0].when.After(f.now) {
+			f.now = f.waiters[0].when
+		}
+		f.fire()
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+}
+
+// fire sends to the channels of all waiters due at or before now,
+// rescheduling tickers. The caller holds f.mu.
+func (f *FakeClock) fire() {
+	for len(f.waiters) > 0 && !f.waiters[0].when.After(f.now) {
+		w := f.waiters[0]
+		f.waiters = f.waiters[1:]
+		select {
+		case w.c <- f.now:
+		default:
+		}
+		if w.period > 0 {
+			w.when = w.when.Add(w.period)
+			f.insert(w)
+		}
+	}
+}
+
+// insert adds w in deadline order. The caller holds f.mu.
+func (f *FakeClock) insert(w *fakeWaiter) {
+	i := sort.Search(len(f.waiters), func(i int) bool { return f.waiters[i].when.After(w.when) })
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = w
+	f.cond.Broadcast()
+}
+
+// remove takes w off the list and returns true if it was on it. The
+// caller holds f.mu.
+func (f *FakeClock) remove(w *fakeWaiter) bool {
+	for i, x := range f.waiters {
+		if x == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// schedule sets w to fire d from now. The caller holds f.mu.
+func (w *fakeWaiter) schedule(d time.Duration) {
+	w.when = w.clock.now.Add(d)
+	w.clock.insert(w)
+}
+
+func (w *fakeWaiter) C() <-chan time.Time { return w.c }
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	f := w.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	active := f.remove(w)
+	if w.period > 0 {
+		if d <= 0 {
+			panic("samplers: non-positive interval for FakeClock Ticker.Reset")
+		}
+		w.period = d
+	}
+	w.schedule(d)
+	f.fire()
+	return active
+}
+
+func (w *fakeWaiter) Stop() bool {
+	f := w.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.remove(w)
+}
+
+// fakeTicker drops the results of Reset() and Stop() to match Ticker
+type fakeTicker struct{ w *fakeWaiter }
+
+func (t fakeTicker) C() <-chan time.Time   { return t.w.c }
+func (t fakeTicker) Reset(d time.Duration) { t.w.Reset(d) }
+func (t fakeTicker) Stop()                 { t.w.Stop() }
@@ -0,0 +1,112 @@
+package samplers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	start := clock.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	tick := clock.NewTicker(2 * time.Second)
+	timer := clock.NewTimer(3 * time.Second)
+	stopped := clock.NewTimer(time.Second)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Stop() of a pending timer should return true once")
+	}
+	if n := clock.Waiters(); n != 2 {
+		t.Errorf("Waiters() = %d, want 2", n)
+	}
+
+	// received is what each channel holds, or zero if none
+	received := func() (ticked, fired time.Time) {
+		select {
+		case ticked = <-tick.C():
+		default:
+		}
+		select {
+		case fired = <-timer.C():
+		default:
+		}
+		return
+	}
+	tests := []struct {
+		advance       time.Duration
+		ticked, fired time.Time
+	}{
+		{time.Second, time.Time{}, time.Time{}},
+		{time.Second, at(2 * time.Second), time.Time{}},
+		{time.Second, time.Time{}, at(3 * time.Second)},
+		// a ticker keeps the first tick that is not read and drops the rest
+		{5 * time.Second, at(4 * time.Second), time.Time{}},
+		{time.Second, time.Time{}, time.Time{}},
+		{time.Second, at(10 * time.Second), time.Time{}},
+	}
+	for i, tt := range tests {
+		clock.Advance(tt.advance)
+		ticked, fired := received()
+		if !ticked.Equal(tt.ticked) || !fired.Equal(tt.fired) {
+			t.Errorf("step %d: ticked %v fired %v, want %v %v", i, ticked, fired, tt.ticked, tt.fired)
+		}
+	}
+
+	if timer.Reset(time.Second) {
+		t.Error("Reset() of a fired timer returned true")
+	}
+	tick.Reset(5 * time.Second)
+	clock.Set(at(15 * time.Second))
+	if ticked, fired := received(); !ticked.Equal(at(15*time.Second)) || !fired.Equal(at(11*time.Second)) {
+		t.Errorf("after Reset(): ticked %v fired %v", ticked, fired)
+	}
+	clock.Set(start)
+	if !clock.Now().Equal(at(15 * time.Second)) {
+		t.Errorf("Set() moved the clock back to %v", clock.Now())
+	}
+	tick.Stop()
+	if n := clock.Waiters(); n != 0 {
+		t.Errorf("Waiters() = %d after Stop(), want 0", n)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		clock.BlockUntil(1)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("BlockUntil(1) returned with no waiters")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.After(time.Second)
+	<-done
+}
+
+func TestAgeColumns(t *testing.T) {
+	type row struct {
+		Name string    `column:"name,sort="`
+		When time.Time `column:"when,time=age"`
+	}
+	clock := NewFakeClock(time.Time{})
+	v := testView(t, row{})
+	v.SetClock(clock)
+	data := []row{{"a", clock.Now()}, {"b", clock.Now().Add(-90 * time.Second)}}
+	for _, tt := range []struct {
+		advance time.Duration
+		want    []string
+	}{
+		{0, []string{"0s", "1m30s"}},
+		{time.Minute, []string{"1m0s", "2m30s"}},
+	} {
+		clock.Advance(tt.advance)
+		rows, err := v.RowsFromSlice(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := []string{rows[0][1], rows[1][1]}; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("after %v: ages %q, want %q", tt.advance, got, tt.want)
+		}
+	}
+}
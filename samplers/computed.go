@@ -0,0 +1,226 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AddComputedColumn adds a column after the others whose cells are the
+// result of expression for each row. tags are column options without the
+// name, e.g. "precision=1", and can be empty. Columns must be set first.
+func (l *layout) AddComputedColumn(name string, expression string, tags string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.addComputedColumn(name, expression, tags)
+}
+
+func (l *layout) addComputedColumn(name string, expression string, tags string) (err error) {
+	if l.columns == nil {
+		return fmt.Errorf("AddComputedColumn(): columns not set")
+	}
+	if columnKey(l.columns, name) != "" {
+		return fmt.Errorf("AddComputedColumn(): column %q already exists", name)
+	}
+	e, err := parseExpr(expression)
+	if err != nil {
+		return
+	}
+	if err = e.resolve(func(field string) (int, bool) {
+		return 0, columnKey(l.columns, field) != ""
+	}); err != nil {
+		return
+	}
+	if tags != "" {
+		tags = name + "," + tags
+	}
+	column, err := parseTags(name, tags)
+	if err != nil {
+		return
+	}
+	if column.rowname {
+		return fmt.Errorf("AddComputedColumn(): computed column %q cannot be the rowname", name)
+	}
+	column.expr, column.added = expression, true
+
+	columns := make(Columns, len(l.columns)+1)
+	for k, c := range l.columns {
+		columns[k] = c
+		if c.number >= column.number {
+			column.number = c.number + 1
+		}
+	}
+	columns[name] = column
+	l.columns = columns
+	l.columnnames = append(append([]string{}, l.columnnames...), column.name)
+	l.encoders = newEncoders(columns)
+	return
+}
+
+// RemoveComputedColumn removes a column added by AddComputedColumn()
+func (l *layout) RemoveComputedColumn(name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.removeComputedColumn(name)
+}
+
+func (l *layout) removeComputedColumn(name string) error {
+	column, ok := l.columns[name]
+	if !ok || !column.added {
+		return fmt.Errorf("RemoveComputedColumn(): no computed column %q", name)
+	}
+	columns := make(Columns, len(l.columns))
+	for k, c := range l.columns {
+		if k != name {
+			columns[k] = c
+		}
+	}
+	var columnnames []string
+	for _, n := range l.columnnames {
+		if n != column.name {
+			columnnames = append(columnnames, n)
+		}
+	}
+	l.columns, l.columnnames = columns, columnnames
+	l.encoders = newEncoders(columns)
+	return nil
+}
+
+// SetComputedParameter sets the name of a sampler parameter holding
+// computed columns, "NAME[,TAGS] := EXPRESSION" separated by semicolons
+func (l *layout) SetComputedParameter(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.computedparam = name
+	l.computedparamvalue = ""
+	l.paramsread = time.Time{}
+}
+
+// refreshComputedParameter replaces the columns from the computed column
+// parameter if it has changed. Errors are logged and change nothing.
+func (l *layout) refreshComputedParameter(parameter func(string) (string, error)) {
+	if l.computedparam == "" {
+		return
+	}
+	value, err := parameter(l.computedparam)
+	if err != nil {
+		ErrorLogger.Printf("computed columns parameter %q: %v", l.computedparam, err)
+		return
+	}
+	if value == l.computedparamvalue {
+		return
+	}
+
+	// keep the current columns so a bad definition leaves things as they were
+	columns, columnnames, encoders, paramcomputed := l.columns, l.columnnames, l.encoders, l.paramcomputed
+	restore := func() {
+		l.columns, l.columnnames, l.encoders, l.paramcomputed = columns, columnnames, encoders, paramcomputed
+	}
+	for _, name := range l.paramcomputed {
+		if err = l.removeComputedColumn(name); err != nil {
+			ErrorLogger.Printf("computed columns parameter %q: %v", l.computedparam, err)
+			restore()
+			return
+		}
+	}
+	l.paramcomputed = nil
+	for _, def := range splitUnquoted(value, ';') {
+		if strings.TrimSpace(def) == "" {
+			continue
+		}
+		i := strings.Index(def, ":=")
+		if i == -1 {
+			ErrorLogger.Printf("computed columns parameter %q: %q is not NAME := EXPRESSION", l.computedparam, def)
+			restore()
+			return
+		}
+		name, tags := strings.TrimSpace(def[:i]), ""
+		if j := strings.IndexByte(name, ','); j != -1 {
+			name, tags = name[:j], name[j+1:]
+		}
+		if err = l.addComputedColumn(name, strings.TrimSpace(def[i+2:]), tags); err != nil {
+			ErrorLogger.Printf("computed columns parameter %q: %v", l.computedparam, err)
+			restore()
+			return
+		}
+		l.paramcomputed = append(l.paramcomputed, name)
+	}
+	l.computedparamvalue = value
+}
+
+// parameterNames returns the names of the computed column, filter and
+// sort order parameters that are set. The caller holds the lock
+func (l *layout) parameterNames() (names []string) {
+	for _, name := range []string{l.computedparam, l.filterparams[0], l.filterparams[1], l.sortparam} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// refreshParameters reads the computed column, filter and sort order
+// parameters, if any, when they were set or last read at least interval
+// ago, and applies those that have changed. Zero interval only reads them
+// once. The parameters are read without the lock held so that a slow
+// Netprobe does not hold up updates.
+func (l *layout) refreshParameters(parameter func(string) (string, error), interval time.Duration) {
+	l.mu.Lock()
+	names := l.parameterNames()
+	now := l.timeSource().Now()
+	due := len(names) > 0 && (l.paramsread.IsZero() || interval > 0 && now.Sub(l.paramsread) >= interval)
+	if due {
+		l.paramsread = now
+	}
+	l.mu.Unlock()
+	if !due {
+		return
+	}
+
+	type result struct {
+		value string
+		err   error
+	}
+	read := make(map[string]result, len(names))
+	for _, name := range names {
+		value, err := parameter(name)
+		read[name] = result{value, err}
+	}
+	cached := func(name string) (string, error) {
+		r := read[name]
+		return r.value, r.err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.paramsread.Equal(now) {
+		// renamed while reading, they are read again on the next refresh
+		return
+	}
+	// computed columns first as the others may use them
+	l.refreshComputedParameter(cached)
+	l.refreshFilterParameters(cached)
+	l.refreshSortParameter(cached)
+}
+
+// splitUnquoted splits s on sep except inside single or double quotes
+func splitUnquoted(s string, sep byte) (parts []string) {
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
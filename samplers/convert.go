@@ -0,0 +1,203 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	converters   = make(map[string]func(interface{}) string)
+	convertersMu sync.RWMutex
+
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+/*
+RegisterConverter adds a named custom converter that columns can select
+with the tag "conv=NAME". The function is passed the value of the field
+and returns the cell contents, bypassing any other formatting. Converters
+must be registered before ColumnInfo() is called for a struct that uses
+them and they must be safe to call from multiple goroutines.
+*/
+func RegisterConverter(name string, f func(interface{}) string) {
+	convertersMu.Lock()
+	defer convertersMu.Unlock()
+	converters[name] = f
+}
+
+func lookupConverter(name string) (f func(interface{}) string, ok bool) {
+	convertersMu.RLock()
+	defer convertersMu.RUnlock()
+	f, ok = converters[name]
+	return
+}
+
+// units are the scales for the unit= tag. Byte units divide a count of
+// bytes and time units divide a count of nanoseconds, which includes
+// time.Duration values.
+var units = map[string]float64{
+	"B":   1,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"ns":  float64(time.Nanosecond),
+	"us":  float64(time.Microsecond),
+	"ms":  float64(time.Millisecond),
+	"s":   float64(time.Second),
+	"min": float64(time.Minute),
+	"h":   float64(time.Hour),
+}
+
+// iecUnits are used by unit=auto to humanise byte counts
+var iecUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// checkConversions returns an error if the conversion tags on a column
+// do not suit the type of the field
+func (column columndetails) checkConversions(key string, t reflect.Type) error {
+	switch {
+	case column.unit != "" && !isNumeric(t):
+		return fmt.Errorf("field %q: unit=%s needs a numeric field, not %v", key, column.unit, t)
+	case column.boollabels != nil && t.Kind() != reflect.Bool:
+		return fmt.Errorf("field %q: bool= needs a bool field, not %v", key, t)
+	case column.enum != nil && !isInteger(t):
+		return fmt.Errorf("field %q: enum= needs an integer field, not %v", key, t)
+	case (column.timeformat != "" || column.location != nil) && t != timeType:
+		return fmt.Errorf("field %q: time= and tz= need a time.Time field, not %v", key, t)
+	}
+	return nil
+}
+
+func isInteger(t reflect.Type) bool {
+	return isNumeric(t) && t.Kind() != reflect.Float32 && t.Kind() != reflect.Float64
+}
+
+// hasConversion returns true if the column uses any of the conversion
+// tags
+func (column columndetails) hasConversion() bool {
+	return column.convfunc != nil || column.unit != "" || column.boollabels != nil ||
+		column.enum != nil || column.timeformat != "" || column.location != nil
+}
+
+// convert renders v using the conversion tags of the column. ok is false
+// if none apply, in which case the value is rendered with the format.
+// Ages are relative to now.
+func (f *fieldEncoder) convert(v reflect.Value, now time.Time) (cell string, ok bool, err error) {
+	column := &f.column
+	switch {
+	case column.convfunc != nil:
+		if !v.CanInterface() {
+			return "", false, fmt.Errorf("field %q: cannot convert unexported field", f.name)
+		}
+		return column.convfunc(v.Interface()), true, nil
+
+	case v.Type() == timeType:
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return "", true, nil
+		}
+		if column.location != nil {
+			t = t.In(column.location)
+		}
+		switch column.timeformat {
+		case "age":
+			return now.Sub(t).Round(time.Second).String(), true, nil
+		case "", "rfc3339":
+			return t.Format(time.RFC3339), true, nil
+		default:
+			return t.Format(column.timeformat), true, nil
+		}
+
+	case column.boollabels != nil:
+		if v.Bool() {
+			return column.boollabels[0], true, nil
+		}
+		return column.boollabels[1], true, nil
+
+	case column.enum != nil:
+		var n int64
+		if v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 {
+			n = int64(v.Uint())
+		} else {
+			n = v.Int()
+		}
+		if label, ok := column.enum[n]; ok {
+			return label, true, nil
+		}
+		return strconv.FormatInt(n, 10), true, nil
+
+	case column.unit == "auto" && v.Type() == durationType:
+		return time.Duration(v.Int()).String(), true, nil
+
+	case column.unit != "":
+		cell, err = f.convertFloat(v.Convert(float64Type).Float())
+		return cell, true, err
+	}
+	return "", false, nil
+}
+
+// convertFloat scales a numeric value, which may be a delta, using the
+// unit tag and renders it with the format. unit=auto formats the values
+// of time.Duration fields as durations and others as bytes.
+func (f *fieldEncoder) convertFloat(value float64) (string, error) {
+	switch f.column.unit {
+	case "":
+		return f.formatFloat(value)
+	case "auto":
+		if f.elapsed {
+			return time.Duration(math.Round(value)).String(), nil
+		}
+		return humanise(value, f.column.precision), nil
+	default:
+		return f.formatFloat(value / units[f.column.unit])
+	}
+}
+
+// humanise renders a count of bytes using the largest IEC unit that
+// leaves a value of at least one, with prec decimal places or 1 if prec
+// is -1
+func humanise(value float64, prec int) string {
+	if prec == -1 {
+		prec = 1
+	}
+	i := 0
+	for ; i < len(iecUnits)-1 && (value >= 1024 || value <= -1024); i++ {
+		value /= 1024
+	}
+	if i == 0 {
+		prec = 0
+	}
+	return strconv.FormatFloat(value, 'f', prec, 64) + " " + iecUnits[i]
+}
+
+// parseLabels parses "a|b|c" style lists for the bool= tag
+func parseLabels(s string) []string {
+	return strings.Split(s, "|")
+}
+
+// parseEnum parses "0:OK|1:WARNING|2:CRITICAL" for the enum= tag
+func parseEnum(s string) (enum map[int64]string, err error) {
+	enum = make(map[int64]string)
+	for _, e := range strings.Split(s, "|") {
+		i := strings.IndexByte(e, ':')
+		if i == -1 {
+			return nil, fmt.Errorf("enum value %q is not in the form NUMBER:LABEL", e)
+		}
+		n, err := strconv.ParseInt(e[:i], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("enum value %q: %w", e, err)
+		}
+		enum[n] = e[i+1:]
+	}
+	return
+}
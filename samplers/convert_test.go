@@ -0,0 +1,169 @@
+package samplers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConversions(t *testing.T) {
+	RegisterConverter("test.upper", func(v interface{}) string {
+		return strings.ToUpper(fmt.Sprint(v))
+	})
+	RegisterConverter("test.hex", func(v interface{}) string {
+		return fmt.Sprintf("0x%04x", v)
+	})
+	when := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	// each data is a slice of one row, the first column is the row name
+	tests := []struct {
+		name string
+		data interface{}
+		want []string
+	}{
+		{"enum", []struct {
+			Name  string `column:"name,sort="`
+			State int    `column:"state,enum=0:OK|1:WARNING|2:CRITICAL"`
+			Other uint8  `column:"other,enum=0x10:low|0x20:high"`
+			Miss  int64  `column:"miss,enum=0:OK"`
+		}{{"a", 2, 0x20, -1}}, []string{"a", "CRITICAL", "high", "-1"}},
+		{"bool", []struct {
+			Name string `column:"name,sort="`
+			Up   bool   `column:"up,bool=UP|DOWN"`
+			Down bool   `column:"down,bool=UP|DOWN"`
+			Set  bool   `column:"set,bool=|unset"`
+		}{{"a", true, false, true}}, []string{"a", "UP", "DOWN", ""}},
+		{"time", []struct {
+			Name   string    `column:"name,sort="`
+			RFC    time.Time `column:"rfc,time=rfc3339"`
+			Layout time.Time `column:"layout,time=2006-01-02 15:04"`
+			Zero   time.Time `column:"zero,time=2006-01-02"`
+		}{{"a", when, when, time.Time{}}},
+			[]string{"a", "2024-03-01T12:30:00Z", "2024-03-01 12:30", ""}},
+		{"tz", []struct {
+			Name   string    `column:"name,sort="`
+			Tokyo  time.Time `column:"tokyo,tz=Asia/Tokyo"`
+			Layout time.Time `column:"layout,time=15:04 MST,tz=Asia/Tokyo"`
+			UTC    time.Time `column:"utc,tz=UTC"`
+		}{{"a", when, when, when.In(time.FixedZone("X", 3600))}},
+			[]string{"a", "2024-03-01T21:30:00+09:00", "21:30 JST", "2024-03-01T12:30:00Z"}},
+		{"byte units", []struct {
+			Name string `column:"name,sort="`
+			B    int    `column:"b,unit=B"`
+			KiB  uint64 `column:"kib,unit=KiB"`
+			MiB  uint64 `column:"mib,unit=MiB,precision=1"`
+			GiB  int64  `column:"gib,unit=GiB"`
+			TiB  uint64 `column:"tib,unit=TiB"`
+			KB   int    `column:"kb,unit=KB"`
+			MB   int    `column:"mb,unit=MB"`
+			GB   int64  `column:"gb,unit=GB"`
+			TB   int64  `column:"tb,unit=TB,format=%.0f TB"`
+		}{{"a", 1500, 1536, 3 << 19, 1 << 29, 1 << 41, 1500, 2.5e6, 1e9, 3e12}},
+			[]string{"a", "1500", "1.50", "1.5", "0.50", "2.00", "1.50", "2.50", "1.00", "3 TB"}},
+		{"time units", []struct {
+			Name string        `column:"name,sort="`
+			NS   int64         `column:"ns,unit=ns"`
+			US   time.Duration `column:"us,unit=us"`
+			MS   time.Duration `column:"ms,unit=ms,precision=0"`
+			S    time.Duration `column:"s,unit=s"`
+			Min  float64       `column:"min,unit=min"`
+			H    time.Duration `column:"h,unit=h,precision=1"`
+		}{{"a", 42, 1500 * time.Nanosecond, 2500 * time.Microsecond, 90 * time.Second, 9e10, 45 * time.Minute}},
+			[]string{"a", "42", "1.50", "2", "90.00", "1.50", "0.8"}},
+		{"auto", []struct {
+			Name  string        `column:"name,sort="`
+			Small int           `column:"small,unit=auto"`
+			Big   uint64        `column:"big,unit=auto,precision=2"`
+			Dur   time.Duration `column:"dur,unit=auto"`
+		}{{"a", 512, 5 << 29, 1500 * time.Millisecond}}, []string{"a", "512 B", "2.50 GiB", "1.5s"}},
+		{"converter", []struct {
+			Name  string `column:"name,sort="`
+			Upper string `column:"upper,conv=test.upper"`
+			Hex   int    `column:"hex,conv=test.hex,format=%d"`
+			// the converter takes precedence over other tags
+			Both int `column:"both,conv=test.hex,unit=KiB"`
+		}{{"a", "abc", 255, 4096}}, []string{"a", "ABC", "0x00ff", "0x1000"}},
+	}
+	for _, tt := range tests {
+		data := reflect.ValueOf(tt.data)
+		v := testView(t, data.Index(0).Interface())
+		rows, err := v.RowsFromSlice(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rows[0], tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, rows[0], tt.want)
+		}
+	}
+}
+
+func TestConversionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    interface{}
+		wantErr string
+	}{
+		{"enum not a number", struct {
+			N int `column:"n,enum=OK:0"`
+		}{}, `enum value "OK:0"`},
+		{"enum no label", struct {
+			N int `column:"n,enum=0:OK|1"`
+		}{}, "NUMBER:LABEL"},
+		{"enum of a string", struct {
+			S string `column:"s,enum=0:OK"`
+		}{}, "needs an integer field"},
+		{"enum of a float", struct {
+			F float64 `column:"f,enum=0:OK"`
+		}{}, "needs an integer field"},
+		{"one bool label", struct {
+			B bool `column:"b,bool=YES"`
+		}{}, "TRUE|FALSE"},
+		{"three bool labels", struct {
+			B bool `column:"b,bool=a|b|c"`
+		}{}, "TRUE|FALSE"},
+		{"bool of an int", struct {
+			N int `column:"n,bool=YES|NO"`
+		}{}, "needs a bool field"},
+		{"time of a string", struct {
+			S string `column:"s,time=rfc3339"`
+		}{}, "need a time.Time field"},
+		{"unknown zone", struct {
+			T time.Time `column:"t,tz=Nowhere/Special"`
+		}{}, "Nowhere/Special"},
+		{"tz of an int", struct {
+			N int64 `column:"n,tz=UTC"`
+		}{}, "need a time.Time field"},
+		{"unknown unit", struct {
+			N int `column:"n,unit=PB"`
+		}{}, "unknown unit"},
+		{"unit case", struct {
+			N int `column:"n,unit=kib"`
+		}{}, "unknown unit"},
+		{"unit of a string", struct {
+			S string `column:"s,unit=KiB"`
+		}{}, "needs a numeric field"},
+		{"unknown converter", struct {
+			S string `column:"s,conv=test.nosuch"`
+		}{}, `no converter registered as "test.nosuch"`},
+		{"empty converter", struct {
+			S string `column:"s,conv="`
+		}{}, "no converter registered"},
+	}
+	// tags are checked by ColumnInfo() and the types of the fields when
+	// the rows are rendered
+	for _, tt := range tests {
+		var v View
+		c, _, _, err := v.ColumnInfo(tt.data)
+		if err == nil {
+			v.SetColumns(c)
+			data := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(tt.data)), 1, 1)
+			_, err = v.RowsFromSlice(data.Interface())
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package samplers_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/samplers"
+	"wonderland.org/geneos/samplertest"
+)
+
+type deltaRow struct {
+	Name  string `column:"name,sort="`
+	Count uint64 `column:"count"`
+}
+
+func TestBaselineUpdateTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	start := func() (*samplertest.Netprobe, *panicky, *samplers.Baseline[map[string]deltaRow]) {
+		n, p := newSampler(t)
+		c, names, sortcol, err := p.ColumnInfo(deltaRow{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.SetColumns(c)
+		p.SetColumnNames(names)
+		p.SetSortColumn(sortcol)
+		b := samplers.NewBaseline[map[string]deltaRow](path, time.Minute)
+		b.SetClock(n.Clock())
+		return n, p, b
+	}
+	sample := func(count uint64) map[string]deltaRow {
+		return map[string]deltaRow{"a": {"a", count}}
+	}
+
+	n, p, b := start()
+	now := n.Clock().Now()
+	if err := b.UpdateTable(p.View, sample(100), now); err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := n.Dataview(samplertest.Entity, samplertest.Sampler, "test", "SYSTEM"); !ok || len(d.RowNames()) != 0 {
+		t.Errorf("rows published without a previous sample: %v", d)
+	}
+
+	// a restarted sampler publishes from its first sample
+	n, p, b = start()
+	n.Clock().Advance(10 * time.Second)
+	if err := b.UpdateTable(p.View, sample(150), now.Add(10*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	d, ok := n.Dataview(samplertest.Entity, samplertest.Sampler, "test", "SYSTEM")
+	if !ok {
+		t.Fatal("dataview not found")
+	}
+	samplertest.AssertCell(t, d, "a", "count", "5")
+
+	if err := b.UpdateTable(p.View, sample(170), now.Add(20*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	d, _ = n.Dataview(samplertest.Entity, samplertest.Sampler, "test", "SYSTEM")
+	samplertest.AssertCell(t, d, "a", "count", "2")
+}
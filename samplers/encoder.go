@@ -0,0 +1,900 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+An encoder is the compiled plan for turning structs of one type into
+rows of cells using a set of Columns. Working out which fields to render,
+in what order and how to format them needs reflection over the type and
+lookups in Columns by name, so this is done once per type and the result
+cached instead of being repeated for every row of every sample.
+*/
+type encoder struct {
+	typ       reflect.Type
+	fields    []fieldEncoder // one per flattened struct field, in field order, then computed columns
+	cells     int            // number of rendered, non-OMIT, cells in a row
+	collect   bool           // there are computed or summary columns, so field values are collected
+	summaries bool           // there are summary columns
+	windowed  bool           // there are window columns
+	now       time.Time      // set before each update, for "age" time columns and windows
+}
+
+// fieldEncoder is the plan for a single struct field
+type fieldEncoder struct {
+	name    string // the key in Columns
+	index   []int  // field index path from the top level struct
+	cell    int    // index of the rendered cell, -1 if OMIT
+	column  columndetails
+	numeric bool // can be converted to float64 for deltas
+	integer bool // an integer kind, so whole computed values are rendered as integers
+	counter int  // wraparound width in bits for counters, 0 if not a counter
+	usefmt  bool // has its own formatting methods, always use fmt
+	marshal bool // has only a MarshalText method, which is used instead
+	elapsed bool // a time.Duration, so unit=auto formats durations not bytes
+	format  formatter
+	verbs   string // the verbs of the format, see formatVerbs()
+	hasconv bool   // uses one of the conversion tags, see convert()
+
+	template []templatePart // for a row name column with a rowname= template
+	expr     *expr          // for a computed column
+}
+
+// templatePart is a piece of a row name template, either literal text
+// or, if field is not -1, the value of another field
+type templatePart struct {
+	text  string
+	field int // index in encoder fields
+}
+
+var (
+	errorType         = reflect.TypeOf((*error)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	formatterType     = reflect.TypeOf((*fmt.Formatter)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	float64Type       = reflect.TypeOf(float64(0))
+)
+
+// encoders caches an encoder for each row type seen for one set of
+// Columns. Views and Tables keep one and replace it when the Columns
+// are changed.
+type encoders struct {
+	columns Columns
+	tagkey  string
+	cache   map[reflect.Type]*encoder
+}
+
+func newEncoders(c Columns) *encoders {
+	return &encoders{columns: c, tagkey: columntag, cache: make(map[reflect.Type]*encoder)}
+}
+
+// forType returns the encoder for rows of type rt, which may be a
+// pointer to a struct
+func (e *encoders) forType(rt reflect.Type) (enc *encoder, err error) {
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if enc = e.cache[rt]; enc != nil {
+		return
+	}
+	if enc, err = newEncoder(e.columns, rt, e.tagkey); err != nil {
+		return
+	}
+	e.cache[rt] = enc
+	return
+}
+
+func newEncoder(c Columns, rt reflect.Type, tagkey string) (enc *encoder, err error) {
+	if rt.Kind() != reflect.Struct {
+		err = fmt.Errorf("row data not a struct")
+		return
+	}
+	fields, err := flattenFields(rt, tagkey)
+	if err != nil {
+		return
+	}
+	enc = &encoder{typ: rt, fields: make([]fieldEncoder, len(fields))}
+	rowname := -1
+	keys := make(map[string]bool, len(fields))
+	for i, sf := range fields {
+		keys[sf.key] = true
+		column, ok := c[sf.key]
+		if !ok {
+			return nil, fmt.Errorf("no column defined for field %q", sf.key)
+		}
+		if sf.expr != "" {
+			// the field only carries the tags, the value comes from
+			// the expression
+			enc.fields[i] = computedEncoder(sf.key, column)
+			continue
+		}
+		ft := sf.typ
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		enc.fields[i] = fieldEncoder{
+			name:    sf.key,
+			index:   sf.index,
+			cell:    -1,
+			column:  column,
+			numeric: isNumeric(ft),
+			integer: isInteger(ft),
+			counter: column.counter,
+			usefmt:  hasFormatMethods(ft),
+			marshal: !hasFormatMethods(ft) && implements(ft, textMarshalerType),
+			elapsed: ft == durationType,
+			format:  compileFormat(column.format),
+			verbs:   formatVerbs(column.format),
+			hasconv: column.hasConversion(),
+		}
+		if err = column.checkConversions(sf.key, ft); err != nil {
+			return nil, err
+		}
+		if column.rowname {
+			if rowname != -1 {
+				return nil, fmt.Errorf("more than one rowname field in %v", rt)
+			}
+			rowname = i
+		}
+	}
+
+	// computed columns added at runtime have no field and follow the
+	// others, in the order they were added
+	var added []string
+	for k, column := range c {
+		if column.expr != "" && !keys[k] {
+			added = append(added, k)
+		}
+	}
+	sort.Slice(added, func(a, b int) bool { return c[added[a]].number < c[added[b]].number })
+	for _, k := range added {
+		enc.fields = append(enc.fields, computedEncoder(k, c[k]))
+	}
+	if err = enc.compileExprs(); err != nil {
+		return nil, err
+	}
+	for _, f := range enc.fields {
+		if f.column.summary != aggNone {
+			enc.summaries, enc.collect = true, true
+		}
+		if f.column.window != nil {
+			enc.windowed, enc.collect = true, true
+		}
+	}
+
+	// the row name is always the first cell, followed by the rest in
+	// field order
+	if rowname != -1 {
+		f := &enc.fields[rowname]
+		f.cell = 0
+		enc.cells++
+		if f.template, err = compileTemplate(f.column.template, fields); err != nil {
+			return nil, err
+		}
+	}
+	for i := range enc.fields {
+		f := &enc.fields[i]
+		if i == rowname || f.column.name == "OMIT" {
+			continue
+		}
+		f.cell = enc.cells
+		enc.cells++
+	}
+	return
+}
+
+func computedEncoder(key string, column columndetails) fieldEncoder {
+	return fieldEncoder{name: key, cell: -1, column: column, format: compileFormat(column.format),
+		verbs: formatVerbs(column.format)}
+}
+
+// compileExprs compiles the expressions of computed columns. They can
+// refer to any field, including OMIT ones, by Columns key or display
+// name, and to computed columns before them
+func (e *encoder) compileExprs() (err error) {
+	for i := range e.fields {
+		f := &e.fields[i]
+		if f.column.expr == "" {
+			continue
+		}
+		if f.expr, err = parseExpr(f.column.expr); err != nil {
+			return
+		}
+		e.collect = true
+		err = f.expr.resolve(func(name string) (int, bool) {
+			for _, byname := range []bool{false, true} {
+				for j, g := range e.fields {
+					if (!byname && g.name == name) || (byname && g.column.name == name) {
+						// only earlier computed columns have values
+						return j, g.column.expr == "" || j < i
+					}
+				}
+			}
+			return 0, false
+		})
+		if err != nil {
+			return fmt.Errorf("computed column %q: %w", f.name, err)
+		}
+	}
+	return
+}
+
+// compileTemplate parses a rowname template, literal text with
+// ${Field} references to other fields by their Columns key
+func compileTemplate(template string, fields []field) (parts []templatePart, err error) {
+	for template != "" {
+		i := strings.Index(template, "${")
+		if i == -1 {
+			parts = append(parts, templatePart{text: template, field: -1})
+			break
+		}
+		if i > 0 {
+			parts = append(parts, templatePart{text: template[:i], field: -1})
+		}
+		j := strings.IndexByte(template[i:], '}')
+		if j == -1 {
+			return nil, fmt.Errorf("rowname template %q: missing '}'", template)
+		}
+		name := template[i+2 : i+j]
+		field := -1
+		for n, f := range fields {
+			if f.key == name {
+				field = n
+				break
+			}
+		}
+		if field == -1 {
+			return nil, fmt.Errorf("rowname template: unknown field %q", name)
+		}
+		parts = append(parts, templatePart{field: field})
+		template = template[i+j+1:]
+	}
+	return
+}
+
+// cell returns the index of the rendered cell for fieldname, or -1 if
+// the field is not rendered
+func (e *encoder) cell(fieldname string) int {
+	for _, f := range e.fields {
+		if f.name == fieldname {
+			return f.cell
+		}
+	}
+	return -1
+}
+
+// structValue dereferences rv and checks it is a row of the right type
+func (e *encoder) structValue(rv reflect.Value) (reflect.Value, error) {
+	rv = reflect.Indirect(rv)
+	if !rv.IsValid() || rv.Type() != e.typ {
+		return rv, fmt.Errorf("row data not a %v", e.typ)
+	}
+	return rv, nil
+}
+
+// render converts a struct to a row of cells, leaving out any OMIT
+// columns. If the encoder collects values then the values of all the
+// fields, for summaries, are returned in vals.
+func (e *encoder) render(rv reflect.Value) (cells []string, vals []interface{}, err error) {
+	if rv, err = e.structValue(rv); err != nil {
+		return
+	}
+	cells = make([]string, e.cells)
+	if e.collect {
+		vals = make([]interface{}, len(e.fields))
+	}
+	for i := range e.fields {
+		f := &e.fields[i]
+		if f.expr != nil || (f.cell == -1 && vals == nil) {
+			continue
+		}
+		v, ok := fieldValue(rv, f.index)
+		if ok && vals != nil {
+			vals[i] = exprValue(v)
+		}
+		if f.cell == -1 {
+			continue
+		}
+		if f.template != nil {
+			cells[f.cell] = e.expand(f.template, rv)
+			continue
+		}
+		if !ok {
+			// nil pointers are empty cells
+			continue
+		}
+		if cells[f.cell], err = f.render(v, e.now); err != nil {
+			return nil, nil, err
+		}
+	}
+	if vals != nil {
+		err = e.compute(cells, vals)
+	}
+	return
+}
+
+// compute evaluates the computed columns, in order, using the values of
+// the other fields in vals
+func (e *encoder) compute(cells []string, vals []interface{}) (err error) {
+	for i := range e.fields {
+		f := &e.fields[i]
+		if f.expr == nil {
+			continue
+		}
+		if vals[i], err = f.expr.eval(vals); err != nil {
+			return fmt.Errorf("computed column %q: %w", f.name, err)
+		}
+		if f.cell == -1 {
+			continue
+		}
+		switch v := vals[i].(type) {
+		case float64:
+			cells[f.cell], err = f.renderFloat(v)
+		case bool:
+			switch {
+			case f.column.boollabels == nil:
+				cells[f.cell] = strconv.FormatBool(v)
+			case v:
+				cells[f.cell] = f.column.boollabels[0]
+			default:
+				cells[f.cell] = f.column.boollabels[1]
+			}
+		case string:
+			cells[f.cell] = v
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// exprValue converts a field value to a float64, string or bool for use
+// in expressions. Other types are their rendered %v value.
+func exprValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return renderPlain(v)
+}
+
+// expand renders a row name template using the plain values of fields
+func (e *encoder) expand(template []templatePart, rv reflect.Value) string {
+	var b strings.Builder
+	for _, p := range template {
+		if p.field == -1 {
+			b.WriteString(p.text)
+			continue
+		}
+		if v, ok := fieldValue(rv, e.fields[p.field].index); ok {
+			b.WriteString(renderPlain(v))
+		}
+	}
+	return b.String()
+}
+
+// renderDelta converts two structs to a row of cells where each numeric
+// field is rendered according to its delta mode, by default the
+// difference between the new and the old value divided by seconds. Other
+// fields are rendered from the new struct. If there is no old struct,
+// i.e. rold is not valid, then the delta cells are left empty.
+func (e *encoder) renderDelta(rnew, rold reflect.Value, seconds float64) (cells []string, vals []interface{}, err error) {
+	if rnew, err = e.structValue(rnew); err != nil {
+		return
+	}
+	haveold := rold.IsValid()
+	if haveold {
+		if rold, err = e.structValue(rold); err != nil {
+			return
+		}
+	}
+	cells = make([]string, e.cells)
+	if e.collect {
+		vals = make([]interface{}, len(e.fields))
+	}
+	for i := range e.fields {
+		f := &e.fields[i]
+		if f.expr != nil || (f.cell == -1 && vals == nil) {
+			continue
+		}
+		if f.template != nil {
+			cells[f.cell] = e.expand(f.template, rnew)
+			continue
+		}
+		newvalue, ok := fieldValue(rnew, f.index)
+		if !ok {
+			continue
+		}
+		// the row name is never a delta
+		if !f.numeric || f.cell == 0 || f.column.delta == deltaAbsolute {
+			if vals != nil {
+				vals[i] = exprValue(newvalue)
+			}
+			if f.cell == -1 {
+				continue
+			}
+			if cells[f.cell], err = f.render(newvalue, e.now); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if !haveold {
+			continue
+		}
+		oldvalue, ok := fieldValue(rold, f.index)
+		if !ok {
+			continue
+		}
+		diff, ok := f.difference(newvalue, oldvalue)
+		if !ok {
+			// counter reset, the new value is the baseline
+			continue
+		}
+		if f.column.delta == deltaRate {
+			diff /= seconds
+		}
+		if vals != nil {
+			vals[i] = diff
+		}
+		if f.cell == -1 {
+			continue
+		}
+		if cells[f.cell], err = f.renderFloat(diff); err != nil {
+			return nil, nil, err
+		}
+	}
+	if vals != nil {
+		err = e.compute(cells, vals)
+	}
+	return
+}
+
+// difference returns newvalue - oldvalue. For counters a decrease is
+// either a wraparound at the counter width, if the old value was in the
+// top half of the range, or else a reset, in which case ok is false.
+// Signed integers are taken as the bits of an unsigned counter.
+func (f *fieldEncoder) difference(newvalue, oldvalue reflect.Value) (diff float64, ok bool) {
+	switch newvalue.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, o := newvalue.Uint(), oldvalue.Uint()
+		if f.counter == 0 && n < o {
+			return -float64(o - n), true
+		}
+		return wrap(n, o, f.counter)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, o := newvalue.Int(), oldvalue.Int()
+		if f.counter == 0 {
+			return float64(n) - float64(o), true
+		}
+		return wrap(uint64(n), uint64(o), f.counter)
+	default:
+		n, o := newvalue.Float(), oldvalue.Float()
+		if f.counter == 0 || n >= o {
+			return n - o, true
+		}
+		max := math.Ldexp(1, f.counter)
+		if o >= max || o < max/2 || n < 0 {
+			return 0, false
+		}
+		return max - o + n, true
+	}
+}
+
+// wrap returns n - o for a counter of width bits
+func wrap(n, o uint64, width int) (float64, bool) {
+	if n >= o {
+		return float64(n - o), true
+	}
+	max := ^uint64(0)
+	if width < 64 {
+		max = uint64(1)<<uint(width) - 1
+	}
+	if o > max || o <= max/2 || n > max {
+		return 0, false
+	}
+	return float64(max-o+n) + 1, true
+}
+
+// fieldValue follows the index path from the struct rv, dereferencing
+// pointers, and returns false if a nil pointer is found on the way or is
+// the field itself
+func fieldValue(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return rv, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(i)
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return rv, false
+		}
+		rv = rv.Elem()
+	}
+	return rv, true
+}
+
+func (f *fieldEncoder) render(v reflect.Value, now time.Time) (string, error) {
+	if f.hasconv {
+		if s, ok, err := f.convert(v, now); ok || err != nil {
+			return s, err
+		}
+	}
+	if !f.usefmt && !f.marshal {
+		if s, ok := f.format.fast(v); ok {
+			return s, nil
+		}
+	}
+	if !v.CanInterface() {
+		return "", fmt.Errorf("field %q: cannot render unexported field", f.name)
+	}
+	if f.marshal {
+		text, err := marshalText(v)
+		if err != nil {
+			return "", fmt.Errorf("field %q: %w", f.name, err)
+		}
+		return f.sprintf(text)
+	}
+	return f.sprintf(v.Interface())
+}
+
+// marshalText returns the MarshalText() of v, which may be on the
+// pointer type
+func marshalText(v reflect.Value) (string, error) {
+	if !v.Type().Implements(textMarshalerType) {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+	}
+	text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	return string(text), err
+}
+
+// renderPlain renders v as %v would, for row names from map keys
+// and templates
+func renderPlain(v reflect.Value) string {
+	if !hasFormatMethods(v.Type()) {
+		if s, ok := plainFormat.fast(v); ok {
+			return s
+		}
+	}
+	if !v.CanInterface() {
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+var plainFormat = compileFormat("%v")
+
+// renderFloat renders a computed value, such as a delta, applying any
+// unit scaling
+func (f *fieldEncoder) renderFloat(value float64) (string, error) {
+	return f.convertFloat(value)
+}
+
+// formatFloat renders a computed value with the column format. Whole
+// values of integer fields, such as the difference between two counters
+// or the sum of a column, are rendered as integers.
+func (f *fieldEncoder) formatFloat(value float64) (string, error) {
+	if f.integer && value == math.Trunc(value) && math.Abs(value) < 1<<63 {
+		n := reflect.ValueOf(int64(value))
+		if s, ok := f.format.fast(n); ok {
+			return s, nil
+		}
+		return f.sprintf(n.Interface())
+	}
+	if s, ok := f.format.float(value, 64); ok {
+		return s, nil
+	}
+	return f.sprintf(value)
+}
+
+// sprintf formats a single value using the column format. fmt does not
+// return errors but instead embeds them in the output as "%!verb(...)"
+// so numbers are converted to suit the verb and then the verbs are
+// checked against the type of value
+func (f *fieldEncoder) sprintf(value interface{}) (cell string, err error) {
+	value = suitVerb(f.verbs, value)
+	if err = checkVerbs(f.verbs, reflect.TypeOf(value)); err != nil {
+		return "", fmt.Errorf("field %q: cannot format %v using %q: %w", f.name, value, f.column.format, err)
+	}
+	return fmt.Sprintf(f.column.format, value), nil
+}
+
+// suitVerb converts a number that the only verb in verbs doesn't suit,
+// e.g. an integer for %f or a float64 for %d, which is rounded. Other
+// values are returned unchanged.
+func suitVerb(verbs string, value interface{}) interface{} {
+	if len(verbs) != 1 || value == nil {
+		return value
+	}
+	verb := verbs[0]
+	v := reflect.ValueOf(value)
+	if verbSuits(verb, v.Type(), map[reflect.Type]bool{}) {
+		return value
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if strings.IndexByte("eEfFgG", verb) != -1 {
+			return float64(v.Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if strings.IndexByte("eEfFgG", verb) != -1 {
+			return float64(v.Uint())
+		}
+	case reflect.Float32, reflect.Float64:
+		n := math.Round(v.Float())
+		if strings.IndexByte("doO", verb) != -1 && math.Abs(n) < 1<<63 {
+			return int64(n)
+		}
+	}
+	return value
+}
+
+// formatVerbs returns the verbs in a Printf format that take a value,
+// with a '*' for each width or precision that takes one, or "?" if the
+// format uses explicit argument indexes and cannot be checked
+func formatVerbs(format string) string {
+	var verbs []byte
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		for i++; i < len(format); i++ {
+			c := format[i]
+			switch {
+			case c == '*':
+				verbs = append(verbs, '*')
+				continue
+			case c == '[':
+				return "?"
+			case strings.IndexByte("+-# 0.", c) != -1 || (c >= '0' && c <= '9'):
+				continue
+			case c != '%':
+				verbs = append(verbs, c)
+			}
+			break
+		}
+	}
+	return string(verbs)
+}
+
+// checkVerbs returns an error if fmt would embed one in the output when
+// formatting a single value of type t with verbs
+func checkVerbs(verbs string, t reflect.Type) error {
+	switch {
+	case verbs == "?":
+		return nil
+	case len(verbs) == 0:
+		return fmt.Errorf("format has no verb")
+	case len(verbs) > 1:
+		return fmt.Errorf("format needs %d values", len(verbs))
+	case t == nil:
+		// a nil interface renders as <nil> whatever the verb
+		return nil
+	case !verbSuits(verbs[0], t, map[reflect.Type]bool{}):
+		return fmt.Errorf("%%%c does not suit %v", verbs[0], t)
+	}
+	return nil
+}
+
+// verbSuits returns true if fmt can format values of type t with verb.
+// Composite types are formatted element by element. Types that may
+// format themselves, and interfaces, are assumed to.
+func verbSuits(verb byte, t reflect.Type, seen map[reflect.Type]bool) bool {
+	if verb == 'v' || verb == 'T' || seen[t] {
+		return true
+	}
+	seen[t] = true
+	if t.Kind() == reflect.Interface || t.Implements(formatterType) {
+		return true
+	}
+	if (t.Implements(errorType) || t.Implements(stringerType)) && strings.IndexByte("sqxX", verb) != -1 {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return verb == 't'
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strings.IndexByte("bcdoOqxXU", verb) != -1
+	case reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return strings.IndexByte("beEfFgGxX", verb) != -1
+	case reflect.String:
+		return strings.IndexByte("sqxX", verb) != -1
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && strings.IndexByte("sqxX", verb) != -1 {
+			return true
+		}
+		if t.Kind() == reflect.Slice && verb == 'p' {
+			return true
+		}
+		return verbSuits(verb, t.Elem(), seen)
+	case reflect.Map:
+		if verb == 'p' {
+			return true
+		}
+		return verbSuits(verb, t.Key(), seen) && verbSuits(verb, t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !verbSuits(verb, t.Field(i).Type, seen) {
+				return false
+			}
+		}
+		return true
+	case reflect.Ptr:
+		if strings.IndexByte("pbdoxX", verb) != -1 {
+			return true
+		}
+		switch t.Elem().Kind() {
+		case reflect.Array, reflect.Slice, reflect.Struct, reflect.Map:
+			return verbSuits(verb, t.Elem(), seen)
+		}
+		return false
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return strings.IndexByte("pbdoxX", verb) != -1
+	}
+	return true
+}
+
+func isNumeric(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// hasFormatMethods returns true if values of type t format themselves, e.g.
+// time.Duration, or may do, e.g. interfaces, and so must go through fmt
+func hasFormatMethods(t reflect.Type) bool {
+	if t.Kind() == reflect.Interface {
+		return true
+	}
+	for _, i := range []reflect.Type{errorType, stringerType, formatterType} {
+		if implements(t, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// implements returns true if t or a pointer to t implements i
+func implements(t reflect.Type, i reflect.Type) bool {
+	return t.Implements(i) || reflect.PtrTo(t).Implements(i)
+}
+
+/*
+formatter is a precompiled Printf format string. Formats made of literal
+text around a single %v, %s, %d, %f, %e or %g verb, with an optional
+precision, are common enough that they are rendered using strconv
+directly. Anything else, including a verb that doesn't match the kind of
+value, is left to fmt.
+*/
+type formatter struct {
+	prefix string
+	suffix string
+	verb   byte // zero if the format is not a simple one
+	prec   int  // -1 if not given
+}
+
+func compileFormat(format string) (f formatter) {
+	var text strings.Builder
+	f.prec = -1
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			text.WriteByte(format[i])
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			text.WriteByte('%')
+			continue
+		}
+		if f.verb != 0 {
+			// more than one verb
+			return formatter{}
+		}
+		prec := -1
+		if i < len(format) && format[i] == '.' {
+			j := i + 1
+			for j < len(format) && format[j] >= '0' && format[j] <= '9' {
+				j++
+			}
+			p, err := strconv.Atoi(format[i+1 : j])
+			if err != nil {
+				return formatter{}
+			}
+			prec, i = p, j
+		}
+		if i >= len(format) || !strings.ContainsRune("vsdfeg", rune(format[i])) {
+			// flags, widths and other verbs
+			return formatter{}
+		}
+		f.verb, f.prec = format[i], prec
+		f.prefix = text.String()
+		text.Reset()
+	}
+	if f.verb != 0 {
+		f.suffix = text.String()
+	}
+	return
+}
+
+// fast renders v if the format is simple and suits the kind of v
+func (f formatter) fast(v reflect.Value) (s string, ok bool) {
+	if f.verb == 0 {
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if f.prec != -1 || (f.verb != 'v' && f.verb != 's') {
+			return
+		}
+		s = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if f.prec != -1 || (f.verb != 'v' && f.verb != 'd') {
+			return
+		}
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f.prec != -1 || (f.verb != 'v' && f.verb != 'd') {
+			return
+		}
+		s = strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return f.float(v.Float(), 32)
+	case reflect.Float64:
+		return f.float(v.Float(), 64)
+	case reflect.Bool:
+		if f.prec != -1 || f.verb != 'v' {
+			return
+		}
+		s = strconv.FormatBool(v.Bool())
+	default:
+		return
+	}
+	return f.prefix + s + f.suffix, true
+}
+
+func (f formatter) float(value float64, bitsize int) (s string, ok bool) {
+	prec := f.prec
+	verb := f.verb
+	switch verb {
+	case 'v':
+		if prec != -1 {
+			return
+		}
+		verb = 'g'
+	case 'f', 'e':
+		if prec == -1 {
+			prec = 6
+		}
+	case 'g':
+	default:
+		return
+	}
+	return f.prefix + strconv.FormatFloat(value, verb, prec, bitsize) + f.suffix, true
+}
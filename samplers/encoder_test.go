@@ -0,0 +1,388 @@
+package samplers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatVerbs(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"%v", "v"},
+		{"%.2f %%", "f"},
+		{"100%%", ""},
+		{"%-8s|%5d", "sd"},
+		{"%*d", "*d"},
+		{"%[1]d", "?"},
+		{"%+.3e", "e"},
+	}
+	for _, tt := range tests {
+		if got := formatVerbs(tt.format); got != tt.want {
+			t.Errorf("formatVerbs(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestCheckVerbs(t *testing.T) {
+	type pair struct {
+		A int
+		B float64
+	}
+	tests := []struct {
+		format string
+		value  interface{}
+		ok     bool
+	}{
+		{"%v", struct{}{}, true},
+		{"%d", 1, true},
+		{"%d", "1", false},
+		{"%s", "100%!", true},
+		{"%.2f", 1.5, true},
+		{"%.2f", 1, false},
+		{"%x", []byte("ab"), true},
+		{"%d", []int{1, 2}, true},
+		{"%d", []string{"a"}, false},
+		{"%d", pair{1, 2}, false},
+		{"%s", time.Second, true},
+		{"%t", true, true},
+		{"%t", 1, false},
+		{"%d", nil, true},
+		{"%d %d", 1, false},
+		{"none", 1, false},
+	}
+	for _, tt := range tests {
+		err := checkVerbs(formatVerbs(tt.format), reflect.TypeOf(tt.value))
+		if (err == nil) != tt.ok {
+			t.Errorf("checkVerbs(%q, %T) = %v, want ok %v", tt.format, tt.value, err, tt.ok)
+		}
+	}
+}
+
+// values are not scanned for fmt errors, only the verbs checked
+func TestSprintfUserData(t *testing.T) {
+	type row struct {
+		Name  string `column:"name"`
+		Value string `column:"value,format=%s"`
+		Count string `column:"count,format=%d"`
+	}
+	v := &View{}
+	c, n, s, err := v.ColumnInfo(row{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetColumns(c)
+	v.SetColumnNames(n)
+	v.SetSortColumn(s)
+	_, err = v.RowsFromSlice([]row{{"a", "100%!", "x"}})
+	if err == nil || !strings.Contains(err.Error(), `field "Count"`) {
+		t.Fatalf("bad verb: got error %v", err)
+	}
+
+	type okrow struct {
+		Name  string `column:"name"`
+		Value string `column:"value,format=%-4s"`
+	}
+	c, n, s, _ = v.ColumnInfo(okrow{})
+	v.SetColumns(c)
+	v.SetColumnNames(n)
+	v.SetSortColumn(s)
+	rows, err := v.RowsFromSlice([]okrow{{"a", "100%!"}, {"b", "%!d(string=x)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows[0][1] != "100%!" || rows[1][1] != "%!d(string=x)" {
+		t.Errorf("got %q", rows)
+	}
+}
+
+func TestSuitVerb(t *testing.T) {
+	tests := []struct {
+		verbs string
+		value interface{}
+		want  interface{}
+	}{
+		{"d", 5.0, int64(5)},
+		{"d", -2.5, int64(-3)},
+		{"f", uint64(3), 3.0},
+		{"e", int8(-1), -1.0},
+		{"x", 1.5, 1.5},
+		{"d", "x", "x"},
+		{"s", 1, 1},
+		{"dd", 1.0, 1.0},
+		{"d", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := suitVerb(tt.verbs, tt.value); got != tt.want {
+			t.Errorf("suitVerb(%q, %#v) = %#v, want %#v", tt.verbs, tt.value, got, tt.want)
+		}
+	}
+}
+
+// a number whose type doesn't suit the verb is converted rather than
+// failing the whole table
+func TestFormatConversions(t *testing.T) {
+	type row struct {
+		Name    string  `column:"name,sort="`
+		Jiffies uint64  `column:"jiffies,format=%.2f"`
+		Count   int     `column:"count,format=%d,delta=delta"`
+		Rate    int     `column:"rate,format=%d"`
+		Ratio   float64 `column:"ratio,format=%d,delta=absolute"`
+	}
+	v := testView(t, row{})
+	old := map[string]row{"a": {"a", 100, 10, 10, 0}}
+	new := map[string]row{"a": {"a", 150, 15, 13, 2.6}}
+	rows, err := v.RowsFromMap(new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "150.00", "15", "13", "3"}; !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("plain: got %q, want %q", rows[0], want)
+	}
+	if rows, err = v.RowsFromMapDelta(new, old, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "25.00", "5", "2", "3"}; !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("delta: got %q, want %q", rows[0], want)
+	}
+}
+
+type benchRow struct {
+	Name   string  `column:"name,sort=+num"`
+	User   uint64  `column:"user,format=%v %%"`
+	System uint64  `column:"system,format=%v %%"`
+	Idle   uint64  `column:"idle"`
+	Ratio  float64 `column:"ratio,format=%.2f"`
+	Label  string
+	Skip   int `column:"OMIT"`
+}
+
+func benchData(n int, mult uint64) map[string]benchRow {
+	m := make(map[string]benchRow, n)
+	for i := 0; i < n; i++ {
+		k := fmt.Sprintf("row%d", i)
+		m[k] = benchRow{k, uint64(i) * mult, uint64(i) * 2 * mult, uint64(i) * 3 * mult, float64(i) / 7, "label", i}
+	}
+	return m
+}
+
+func benchView(b *testing.B) *View {
+	v := &View{}
+	c, n, s, err := v.ColumnInfo(benchRow{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	v.SetColumns(c)
+	v.SetColumnNames(n)
+	v.SetSortColumn(s)
+	return v
+}
+
+func benchSlice() []benchRow {
+	m := benchData(5000, 1)
+	d := make([]benchRow, 0, len(m))
+	for _, r := range m {
+		d = append(d, r)
+	}
+	return d
+}
+
+// reflectRow renders a row the way rows were rendered before encoders,
+// looking up each field in Columns by name and formatting it with fmt
+func reflectRow(c Columns, rv reflect.Value) (cells []string) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		column := c[rt.Field(i).Name]
+		if column.name == "OMIT" {
+			continue
+		}
+		cells = append(cells, fmt.Sprintf(column.format, rv.Field(i).Interface()))
+	}
+	return
+}
+
+// BenchmarkRender compares rendering rows by reflecting over each one
+// with the cached encoder, without the sorting and other steps
+func BenchmarkRender(b *testing.B) {
+	v := benchView(b)
+	d := reflect.ValueOf(benchSlice())
+	b.Run("reflect", func(b *testing.B) {
+		c := v.Columns()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for r := 0; r < d.Len(); r++ {
+				reflectRow(c, d.Index(r))
+			}
+		}
+	})
+	b.Run("encoder", func(b *testing.B) {
+		enc, err := v.encoderCache().forType(d.Type().Elem())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for r := 0; r < d.Len(); r++ {
+				if _, _, err = enc.render(d.Index(r)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkRowsFromMap(b *testing.B) {
+	v := benchView(b)
+	d := benchData(5000, 1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.RowsFromMap(d); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRowsFromMapDelta(b *testing.B) {
+	v := benchView(b)
+	n, o := benchData(5000, 2), benchData(5000, 1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.RowsFromMapDelta(n, o, time.Second); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRowsFromSlice(b *testing.B) {
+	v := benchView(b)
+	d := benchSlice()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := v.RowsFromSlice(d); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDifference(t *testing.T) {
+	const max32 = 1<<32 - 1
+	tests := []struct {
+		name     string
+		counter  int
+		new, old interface{}
+		want     float64
+		ok       bool
+	}{
+		{"uint up", 0, uint64(10), uint64(4), 6, true},
+		{"uint gauge down", 0, uint64(4), uint64(10), -6, true},
+		{"uint32 wrap", 32, uint32(5), uint32(max32 - 4), 10, true},
+		{"uint64 wrap", 64, ^uint64(0) - 1, ^uint64(0) - 3, 2, true},
+		{"uint64 wrap at 32", 32, uint64(5), uint64(max32 - 4), 10, true},
+		{"uint reset", 32, uint64(5), uint64(1000), 0, false},
+		{"uint over width", 32, uint64(5), uint64(max32 + 10), 0, false},
+		{"int gauge down", 0, int64(-5), int64(5), -10, true},
+		{"int32 counter wrap", 32, int64(5), int64(max32 - 4), 10, true},
+		{"int64 counter wrap", 64, int64(3), int64(-5), 8, true},
+		{"int reset", 32, int64(5), int64(1000), 0, false},
+		{"float gauge down", 0, 1.5, 3.0, -1.5, true},
+		{"float wrap", 32, 5.0, float64(max32 - 4), 10, true},
+		{"float reset", 64, 5.0, 1000.0, 0, false},
+	}
+	for _, tt := range tests {
+		f := &fieldEncoder{counter: tt.counter}
+		got, ok := f.difference(reflect.ValueOf(tt.new), reflect.ValueOf(tt.old))
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%s: difference(%v, %v) = %v, %v, want %v, %v", tt.name, tt.new, tt.old, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRowsFromMapDelta(t *testing.T) {
+	type row struct {
+		Name   string `column:"name,sort="`
+		Rate   uint64 `column:"rate"`
+		Diff   uint64 `column:"diff,delta=delta"`
+		Gauge  uint64 `column:"gauge,delta=absolute"`
+		Wraps  uint32 `column:"wraps,counter=32,delta=delta"`
+		Signed int64  `column:"signed,counter=32,delta=delta"`
+	}
+	v := testView(t, row{})
+	old := map[string]row{
+		"a":    {"a", 100, 100, 7, 1<<32 - 2, 10},
+		"b":    {"b", 100, 100, 7, 100, 10},
+		"gone": {"gone", 1, 1, 1, 1, 1},
+	}
+	new := map[string]row{
+		"a":   {"a", 300, 50, 9, 3, 20},
+		"b":   {"b", 100, 150, 5, 50, 5},
+		"new": {"new", 1, 1, 1, 1, 1},
+	}
+	rows, err := v.RowsFromMapDelta(new, old, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"a", "100", "-50", "9", "5", "10"},
+		{"b", "0", "50", "5", "", ""},
+		{"new", "", "", "1", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got  %q\nwant %q", rows, want)
+	}
+}
+
+// whole deltas of integer fields are rendered as integers, rates as floats
+func TestIntegerDeltas(t *testing.T) {
+	type row struct {
+		Name  string `column:"name,sort="`
+		Bytes uint64 `column:"bytes,delta=delta"`
+		Ticks uint32 `column:"ticks,format=%d,counter=32,delta=delta"`
+		Rate  int64  `column:"rate"`
+		Pct   uint64 `column:"pct,format=%.1f %%"`
+	}
+	v := testView(t, row{})
+	old := map[string]row{"a": {"a", 1 << 40, 1<<32 - 10, 0, 0}}
+	new := map[string]row{"a": {"a", 1<<40 + 5e6, 10, 5, 30}}
+	rows, err := v.RowsFromMapDelta(new, old, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "5000000", "20", "2.5", "15.0 %"}; !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("got %q, want %q", rows[0], want)
+	}
+}
+
+func TestUnitAuto(t *testing.T) {
+	type row struct {
+		Name  string        `column:"name,sort="`
+		Bytes uint64        `column:"bytes,unit=auto,delta=absolute"`
+		Rate  uint64        `column:"rate,unit=auto"`
+		Up    time.Duration `column:"up,unit=auto,delta=absolute"`
+		Busy  time.Duration `column:"busy,unit=auto"`
+		Wait  time.Duration `column:"wait,unit=auto,delta=delta"`
+	}
+	v := testView(t, row{})
+	old := map[string]row{"a": {"a", 0, 0, 0, time.Second, time.Second}}
+	new := map[string]row{"a": {"a", 1536, 3 << 20, 90 * time.Second, 2 * time.Second, 1500 * time.Millisecond}}
+
+	rows, err := v.RowsFromMap(new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "1.5 KiB", "3.0 MiB", "1m30s", "2s", "1.5s"}
+	if !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("absolute: got %q, want %q", rows[0], want)
+	}
+
+	if rows, err = v.RowsFromMapDelta(new, old, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"a", "1.5 KiB", "1.5 MiB", "1m30s", "500ms", "500ms"}
+	if !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("delta: got %q, want %q", rows[0], want)
+	}
+}
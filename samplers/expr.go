@@ -0,0 +1,523 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// expr is a compiled expression for a computed column, see the README
+// for the language. Values are float64, string, bool or nil for null.
+type expr struct {
+	source string
+	root   exprNode
+}
+
+// exprNode is a node in the parsed expression. vals are the values of
+// the fields of the row, by index in the encoder
+type exprNode interface {
+	eval(vals []interface{}) (interface{}, error)
+}
+
+type (
+	exprLiteral struct{ value interface{} }
+	exprField   struct {
+		name  string
+		index int
+	}
+	exprUnary struct {
+		op string
+		x  exprNode
+	}
+	exprBinary struct {
+		op   string
+		x, y exprNode
+	}
+	exprCall struct {
+		name string
+		args []exprNode
+	}
+)
+
+// exprFuncs are the functions and their minimum and maximum number of
+// arguments, -1 for any
+var exprFuncs = map[string][2]int{
+	"if":       {3, 3},
+	"min":      {1, -1},
+	"max":      {1, -1},
+	"abs":      {1, 1},
+	"round":    {1, 2},
+	"upper":    {1, 1},
+	"lower":    {1, 1},
+	"contains": {2, 2},
+}
+
+// parseExpr compiles source, checking the syntax and function calls.
+// Field names are resolved later, by resolve()
+func parseExpr(source string) (e *expr, err error) {
+	p := &exprParser{src: source}
+	var root exprNode
+	if err = p.next(); err == nil {
+		root, err = p.parse(0)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", source, err)
+	}
+	if p.tok != "" {
+		return nil, fmt.Errorf("expression %q: unexpected %q", source, p.tok)
+	}
+	return &expr{source: source, root: root}, nil
+}
+
+// resolve sets the index of each field referenced by the expression
+// using lookup, which returns false for an unknown name
+func (e *expr) resolve(lookup func(name string) (int, bool)) error {
+	return walkExpr(e.root, func(n exprNode) error {
+		if f, ok := n.(*exprField); ok {
+			i, ok := lookup(f.name)
+			if !ok {
+				return fmt.Errorf("expression %q: unknown field %q", e.source, f.name)
+			}
+			f.index = i
+		}
+		return nil
+	})
+}
+
+func walkExpr(n exprNode, f func(exprNode) error) error {
+	if err := f(n); err != nil {
+		return err
+	}
+	switch n := n.(type) {
+	case *exprUnary:
+		return walkExpr(n.x, f)
+	case *exprBinary:
+		if err := walkExpr(n.x, f); err != nil {
+			return err
+		}
+		return walkExpr(n.y, f)
+	case *exprCall:
+		for _, a := range n.args {
+			if err := walkExpr(a, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *expr) eval(vals []interface{}) (interface{}, error) {
+	v, err := e.root.eval(vals)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %w", e.source, err)
+	}
+	return v, nil
+}
+
+// exprParser is a precedence climbing parser over a simple scanner
+type exprParser struct {
+	src    string
+	pos    int
+	tok    string // current token, "" at the end
+	kind   byte   // 'n'umber, 's'tring, 'i'dentifier or 'o'perator
+	strval string // unquoted value of a string token
+}
+
+var exprPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+func (p *exprParser) next() error {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+	p.tok, p.kind = "", 0
+	if p.pos >= len(p.src) {
+		return nil
+	}
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case isDigit(c) || (c == '.' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1])):
+		p.kind = 'n'
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+			p.pos++
+			if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+				p.pos++
+			}
+			for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+				p.pos++
+			}
+		}
+	case c == '\'' || c == '"':
+		p.kind = 's'
+		var b strings.Builder
+		for p.pos++; ; p.pos++ {
+			if p.pos >= len(p.src) {
+				return fmt.Errorf("unterminated string")
+			}
+			if p.src[p.pos] == '\\' && p.pos+1 < len(p.src) {
+				p.pos++
+			} else if p.src[p.pos] == c {
+				p.pos++
+				break
+			}
+			b.WriteByte(p.src[p.pos])
+		}
+		p.strval = b.String()
+	case c == '_' || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+		p.kind = 'i'
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			if c != '_' && c != '.' && !isDigit(c) && !(c|0x20 >= 'a' && c|0x20 <= 'z') {
+				break
+			}
+			p.pos++
+		}
+	default:
+		p.kind = 'o'
+		if p.pos+1 < len(p.src) {
+			switch p.src[p.pos : p.pos+2] {
+			case "==", "!=", "<=", ">=", "&&", "||":
+				p.pos += 2
+				p.tok = p.src[start:p.pos]
+				return nil
+			}
+		}
+		if !strings.ContainsRune("+-*/%()<>!,", rune(c)) {
+			return fmt.Errorf("unexpected character %q", c)
+		}
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+	return nil
+}
+
+// parse parses a binary expression whose operators bind tighter than
+// minprec
+func (p *exprParser) parse(minprec int) (x exprNode, err error) {
+	if x, err = p.unary(); err != nil {
+		return
+	}
+	for {
+		prec, ok := exprPrecedence[p.tok]
+		if p.kind != 'o' || !ok || prec <= minprec {
+			return
+		}
+		op := p.tok
+		if err = p.next(); err != nil {
+			return
+		}
+		y, err := p.parse(prec)
+		if err != nil {
+			return nil, err
+		}
+		x = &exprBinary{op: op, x: x, y: y}
+	}
+}
+
+func (p *exprParser) unary() (x exprNode, err error) {
+	if p.kind == 'o' && (p.tok == "-" || p.tok == "!") {
+		op := p.tok
+		if err = p.next(); err != nil {
+			return
+		}
+		if x, err = p.unary(); err != nil {
+			return
+		}
+		return &exprUnary{op: op, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (x exprNode, err error) {
+	tok, kind := p.tok, p.kind
+	switch kind {
+	case 0:
+		return nil, fmt.Errorf("unexpected end")
+	case 'n':
+		n, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", tok)
+		}
+		x = &exprLiteral{n}
+	case 's':
+		x = &exprLiteral{p.strval}
+	case 'i':
+		if err = p.next(); err != nil {
+			return
+		}
+		switch {
+		case p.tok == "(" && p.kind == 'o':
+			return p.call(tok)
+		case tok == "true" || tok == "false":
+			return &exprLiteral{tok == "true"}, nil
+		}
+		return &exprField{name: tok, index: -1}, nil
+	case 'o':
+		if tok != "(" {
+			return nil, fmt.Errorf("unexpected %q", tok)
+		}
+		if err = p.next(); err != nil {
+			return
+		}
+		if x, err = p.parse(0); err != nil {
+			return
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+	}
+	err = p.next()
+	return
+}
+
+// call parses the arguments of a function call, the current token being
+// the opening parenthesis
+func (p *exprParser) call(name string) (x exprNode, err error) {
+	nargs, ok := exprFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q", name)
+	}
+	c := &exprCall{name: name}
+	if err = p.next(); err != nil {
+		return
+	}
+	for p.tok != ")" {
+		a, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, a)
+		if p.tok == "," {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+		} else if p.tok != ")" {
+			return nil, fmt.Errorf("missing ')' after arguments to %s()", name)
+		}
+	}
+	if len(c.args) < nargs[0] || (nargs[1] != -1 && len(c.args) > nargs[1]) {
+		return nil, fmt.Errorf("wrong number of arguments to %s()", name)
+	}
+	err = p.next()
+	return c, err
+}
+
+func (l *exprLiteral) eval(vals []interface{}) (interface{}, error) {
+	return l.value, nil
+}
+
+func (f *exprField) eval(vals []interface{}) (interface{}, error) {
+	return vals[f.index], nil
+}
+
+func (u *exprUnary) eval(vals []interface{}) (interface{}, error) {
+	x, err := u.x.eval(vals)
+	if err != nil || x == nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case float64:
+		if u.op == "-" {
+			return -x, nil
+		}
+	case bool:
+		if u.op == "!" {
+			return !x, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid operand for %s: %v", u.op, x)
+}
+
+func (b *exprBinary) eval(vals []interface{}) (interface{}, error) {
+	x, err := b.x.eval(vals)
+	if err != nil {
+		return nil, err
+	}
+	// && and || only evaluate the right hand side if needed
+	if b.op == "&&" || b.op == "||" {
+		if x == nil {
+			return nil, nil
+		}
+		xb, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid operand for %s: %v", b.op, x)
+		}
+		if xb == (b.op == "||") {
+			return xb, nil
+		}
+		y, err := b.y.eval(vals)
+		if err != nil || y == nil {
+			return nil, err
+		}
+		if yb, ok := y.(bool); ok {
+			return yb, nil
+		}
+		return nil, fmt.Errorf("invalid operand for %s: %v", b.op, y)
+	}
+	y, err := b.y.eval(vals)
+	if err != nil || x == nil || y == nil {
+		return nil, err
+	}
+
+	switch x := x.(type) {
+	case float64:
+		if y, ok := y.(float64); ok {
+			return numericOp(b.op, x, y)
+		}
+		if y, ok := y.(string); ok && b.op == "+" {
+			return strconv.FormatFloat(x, 'g', -1, 64) + y, nil
+		}
+	case string:
+		switch y := y.(type) {
+		case string:
+			switch b.op {
+			case "+":
+				return x + y, nil
+			case "==":
+				return x == y, nil
+			case "!=":
+				return x != y, nil
+			case "<":
+				return x < y, nil
+			case "<=":
+				return x <= y, nil
+			case ">":
+				return x > y, nil
+			case ">=":
+				return x >= y, nil
+			}
+		case float64:
+			if b.op == "+" {
+				return x + strconv.FormatFloat(y, 'g', -1, 64), nil
+			}
+		}
+	case bool:
+		if y, ok := y.(bool); ok {
+			switch b.op {
+			case "==":
+				return x == y, nil
+			case "!=":
+				return x != y, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid operands for %s: %v and %v", b.op, x, y)
+}
+
+func numericOp(op string, x, y float64) (interface{}, error) {
+	switch op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/":
+		if y == 0 {
+			return nil, nil
+		}
+		return x / y, nil
+	case "%":
+		if y == 0 {
+			return nil, nil
+		}
+		return math.Mod(x, y), nil
+	case "==":
+		return x == y, nil
+	case "!=":
+		return x != y, nil
+	case "<":
+		return x < y, nil
+	case "<=":
+		return x <= y, nil
+	case ">":
+		return x > y, nil
+	case ">=":
+		return x >= y, nil
+	}
+	return nil, fmt.Errorf("invalid operands for %s: %v and %v", op, x, y)
+}
+
+func (c *exprCall) eval(vals []interface{}) (interface{}, error) {
+	if c.name == "if" {
+		// only the branch taken is evaluated
+		cond, err := c.args[0].eval(vals)
+		if err != nil || cond == nil {
+			return nil, err
+		}
+		b, ok := cond.(bool)
+		if !ok {
+			return nil, fmt.Errorf("if(): condition %v is not a bool", cond)
+		}
+		if b {
+			return c.args[1].eval(vals)
+		}
+		return c.args[2].eval(vals)
+	}
+
+	args := make([]interface{}, len(c.args))
+	for i, a := range c.args {
+		v, err := a.eval(vals)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	switch c.name {
+	case "upper", "lower", "contains":
+		strs := make([]string, len(args))
+		for i, a := range args {
+			s, ok := a.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s(): %v is not a string", c.name, a)
+			}
+			strs[i] = s
+		}
+		switch c.name {
+		case "upper":
+			return strings.ToUpper(strs[0]), nil
+		case "lower":
+			return strings.ToLower(strs[0]), nil
+		default:
+			return strings.Contains(strs[0], strs[1]), nil
+		}
+	}
+
+	nums := make([]float64, len(args))
+	for i, a := range args {
+		n, ok := a.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s(): %v is not a number", c.name, a)
+		}
+		nums[i] = n
+	}
+	switch c.name {
+	case "min", "max":
+		r := nums[0]
+		for _, n := range nums[1:] {
+			if (c.name == "min") == (n < r) {
+				r = n
+			}
+		}
+		return r, nil
+	case "abs":
+		return math.Abs(nums[0]), nil
+	default: // round
+		scale := 1.0
+		if len(nums) > 1 {
+			scale = math.Pow(10, math.Trunc(nums[1]))
+		}
+		return math.Round(nums[0]*scale) / scale, nil
+	}
+}
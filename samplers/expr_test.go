@@ -0,0 +1,149 @@
+package samplers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpr(t *testing.T) {
+	names := []string{"Used", "Total", "Name", "Up", "Missing", "Rx.Bytes"}
+	vals := []interface{}{25.0, 200.0, "disk1", true, nil, 1536.0}
+	tests := []struct {
+		source string
+		want   interface{}
+		err    string // substring of the parse or eval error
+	}{
+		{"Used/Total*100", 12.5, ""},
+		{"1 + 2 * 3", 7.0, ""},
+		{"(1 + 2) * 3", 9.0, ""},
+		{"-Used + 5", -20.0, ""},
+		{"7 % 4", 3.0, ""},
+		{"1e3 / 4", 250.0, ""},
+		{"Rx.Bytes / 1024", 1.5, ""},
+		{"Name + ':' + Used", "disk1:25", ""},
+		{`"a" < 'b'`, true, ""},
+		{"Used > 10 && Up", true, ""},
+		{"Used > 100 || !Up", false, ""},
+		{"Used >= 25 && Total != 200", false, ""},
+		{"if(Used > 20, 'WARN', 'OK')", "WARN", ""},
+		{"if(Up, 1, Missing)", 1.0, ""},
+		{"min(3, Used, 2)", 2.0, ""},
+		{"max(3, Used, 2)", 25.0, ""},
+		{"abs(-2.5)", 2.5, ""},
+		{"round(2/3, 2)", 0.67, ""},
+		{"round(2.5)", 3.0, ""},
+		{"upper(Name)", "DISK1", ""},
+		{"contains(lower('ABC'), 'b')", true, ""},
+
+		// nulls
+		{"Missing + 1", nil, ""},
+		{"Used / 0", nil, ""},
+		{"Used % 0", nil, ""},
+		{"Missing > 1 && Up", nil, ""},
+		{"false && Missing", false, ""},
+
+		// errors
+		{"Used +", nil, "unexpected"},
+		{"(1 + 2", nil, ""},
+		{"1 2", nil, "unexpected"},
+		{"'abc", nil, ""},
+		{"nosuch(1)", nil, "nosuch"},
+		{"if(1, 2)", nil, "if"},
+		{"Unknown + 1", nil, `unknown field "Unknown"`},
+		{"Name * 2", nil, "invalid operands"},
+		{"!Used", nil, "invalid operand"},
+		{"upper(Used)", nil, "not a string"},
+		{"abs(Name)", nil, "not a number"},
+		{"if(Used, 1, 2)", nil, "not a bool"},
+	}
+	for _, tt := range tests {
+		e, err := parseExpr(tt.source)
+		if err == nil {
+			err = e.resolve(func(name string) (int, bool) {
+				for i, n := range names {
+					if n == name {
+						return i, true
+					}
+				}
+				return 0, false
+			})
+		}
+		var got interface{}
+		if err == nil {
+			got, err = e.eval(vals)
+		}
+		if tt.err != "" || (err != nil && tt.want == nil) {
+			if err == nil {
+				t.Errorf("%s: got %v, want an error", tt.source, got)
+			} else if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %q, want one containing %q", tt.source, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestComputedColumns(t *testing.T) {
+	type row struct {
+		Name   string   `column:"disk,sort="`
+		Used   uint64   `column:"used"`
+		Total  uint64   `column:"OMIT"`
+		Errors uint64   `column:"errors"`
+		Ptr    *int     `column:"OMIT"`
+		_      struct{} `column:"pctUsed,precision=1" expr:"Used/Total*100"`
+		_      struct{} `column:"status" expr:"if(errors > 0 || pctUsed > 90, 'WARN', 'OK')"`
+		_      struct{} `column:"ptr" expr:"Ptr + 1"`
+	}
+	v := testView(t, row{})
+	if err := v.AddComputedColumn("free", "Total - used", "summary=sum"); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][3]string{{"free", "1", ""}, {"x", "nosuch + 1", ""}, {"x", "1 +", ""}, {"x", "1", "rowname="}} {
+		if err := v.AddComputedColumn(bad[0], bad[1], bad[2]); err == nil {
+			t.Errorf("AddComputedColumn(%q, %q, %q): no error", bad[0], bad[1], bad[2])
+		}
+	}
+	wantNames := []string{"disk", "used", "errors", "pctUsed", "status", "ptr", "free"}
+	if got := v.ColumnNames(); !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("ColumnNames() = %q, want %q", got, wantNames)
+	}
+	one := 1
+	rows, err := v.RowsFromMap(map[string]row{
+		"a": {Name: "a", Used: 50, Total: 200, Ptr: &one},
+		"b": {Name: "b", Used: 95, Total: 100},
+		"c": {Name: "c", Used: 0, Total: 0, Errors: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"a", "50", "0", "25.0", "OK", "2", "150"},
+		{"b", "95", "0", "95.0", "WARN", "", "5"},
+		{"c", "0", "2", "", "WARN", "", "0"},
+		{"_Total", "", "", "", "", "", "155"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got  %q\nwant %q", rows, want)
+	}
+
+	if err = v.RemoveComputedColumn("free"); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.RemoveComputedColumn("pctUsed"); err == nil {
+		t.Error("RemoveComputedColumn() of a tagged column: no error")
+	}
+	if got := v.ColumnNames(); !reflect.DeepEqual(got, wantNames[:6]) {
+		t.Errorf("after RemoveComputedColumn(): %q", got)
+	}
+	if _, err = v.RowsFromMap(map[string]row{"a": {Name: "a"}}); err != nil {
+		t.Errorf("after RemoveComputedColumn(): %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// filterRule matches the cells of one column against a pattern
+type filterRule struct {
+	column string // the key in Columns, empty for the row name
+	re     *regexp.Regexp
+}
+
+// rowFilter is a set of include and exclude rules. A row is shown if,
+// for every column with include rules, its cell matches at least one of
+// them and no exclude rule matches.
+type rowFilter struct {
+	include []filterRule
+	exclude []filterRule
+}
+
+/*
+parseFilterRules parses a semicolon separated list of COLUMN=PATTERN
+rules, where COLUMN is a display name or Columns key and PATTERN is a
+glob, e.g. "loop*", or a regular expression if it starts "re:", e.g.
+"re:^/data". A rule is only split on the first "=" if what comes before
+it is a column, otherwise the whole rule is a pattern for the row name.
+*/
+func parseFilterRules(c Columns, spec string) (rules []filterRule, err error) {
+	for _, s := range splitUnquoted(spec, ';') {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		var r filterRule
+		pattern := s
+		if i := strings.IndexByte(s, '='); i != -1 {
+			if r.column = columnKey(c, strings.TrimSpace(s[:i])); r.column != "" {
+				pattern = strings.TrimSpace(s[i+1:])
+			}
+		}
+		if strings.HasPrefix(pattern, "re:") {
+			r.re, err = regexp.Compile(pattern[3:])
+		} else {
+			r.re, err = regexp.Compile(globToRegexp(pattern))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: %w", s, err)
+		}
+		rules = append(rules, r)
+	}
+	return
+}
+
+// globToRegexp converts a shell style glob, with *, ? and [...], to an
+// anchored regular expression. Unlike path.Match a * also matches /
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteByte('.')
+		case '[':
+			j := strings.IndexByte(glob[i:], ']')
+			if j == -1 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteByte('$')
+	return b.String()
+}
+
+/*
+SetRowFilter sets rules to include and exclude rows, each a semicolon
+separated list of COLUMN=PATTERN, where PATTERN is a glob or, prefixed
+with "re:", a regular expression, e.g.
+
+	err = p.SetRowFilter("mount=re:^/data", "device=loop*")
+
+Columns are given by display name and a rule without a column, or where
+the text before the "=" is not a column, applies to the row name. When a
+column has include rules a row must match one of them, and a row
+matching any exclude rule is dropped. Patterns match the rendered cell.
+Filters are applied before sorting, row limits and summaries. Empty
+lists remove the filter.
+
+Rules are resolved against the columns when they are set, so
+SetColumns() must be called first and it is an error otherwise.
+*/
+func (l *layout) SetRowFilter(include string, exclude string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.setRowFilter(include, exclude)
+}
+
+func (l *layout) setRowFilter(include string, exclude string) (err error) {
+	var f rowFilter
+	if f.include, err = parseFilterRules(l.columns, include); err != nil {
+		return
+	}
+	if f.exclude, err = parseFilterRules(l.columns, exclude); err != nil {
+		return
+	}
+	if f.include == nil && f.exclude == nil {
+		l.filter = nil
+		return
+	}
+	if l.columns == nil {
+		return fmt.Errorf("SetRowFilter(): no columns, call SetColumns() first")
+	}
+	l.filter = &f
+	return
+}
+
+// SetFilterParameters sets the names of sampler parameters holding the
+// include and exclude lists for SetRowFilter(), either of which can be
+// empty
+func (l *layout) SetFilterParameters(include string, exclude string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.filterparams = [2]string{include, exclude}
+	l.filterparamvalues = [2]string{}
+	l.paramsread = time.Time{}
+}
+
+// refreshFilterParameters reads the filter parameters, if any, using
+// parameter and updates the filter if they have changed. Errors are
+// logged and leave the current filter in place.
+func (l *layout) refreshFilterParameters(parameter func(string) (string, error)) {
+	if l.filterparams == [2]string{} {
+		return
+	}
+	var values [2]string
+	for i, name := range l.filterparams {
+		if name == "" {
+			continue
+		}
+		v, err := parameter(name)
+		if err != nil {
+			ErrorLogger.Printf("filter parameter %q: %v", name, err)
+			return
+		}
+		values[i] = v
+	}
+	if values == l.filterparamvalues {
+		return
+	}
+	if err := l.setRowFilter(values[0], values[1]); err != nil {
+		ErrorLogger.Printf("filter parameters %q: %v", l.filterparams, err)
+		return
+	}
+	l.filterparamvalues = values
+}
+
+// filterRows drops the rows, and their vals if not nil, that do not
+// pass the filter
+func (l *layout) filterRows(enc *encoder, rows [][]string, vals [][]interface{}) ([][]string, [][]interface{}) {
+	if l.filter == nil {
+		return rows, vals
+	}
+	include, exclude := enc.filterCells(l.filter.include), enc.filterCells(l.filter.exclude)
+	n := 0
+	for i, row := range rows {
+		if !matchRow(row, include, true) || matchRow(row, exclude, false) {
+			continue
+		}
+		rows[n] = row
+		if vals != nil {
+			vals[n] = vals[i]
+		}
+		n++
+	}
+	if vals != nil {
+		vals = vals[:n]
+	}
+	return rows[:n], vals
+}
+
+// cellRule is a filterRule with the column resolved to a cell
+type cellRule struct {
+	cell int
+	re   *regexp.Regexp
+}
+
+// filterCells resolves the cells of rules, leaving out OMIT columns
+func (e *encoder) filterCells(rules []filterRule) (cr []cellRule) {
+	for _, r := range rules {
+		cell := 0
+		if r.column != "" {
+			if cell = e.cell(r.column); cell == -1 {
+				continue
+			}
+		}
+		cr = append(cr, cellRule{cell, r.re})
+	}
+	return
+}
+
+// matchRow returns true if the row matches the rules. For include rules
+// (all is true) each column with rules must match one of them, otherwise
+// any match is enough.
+func matchRow(row []string, rules []cellRule, all bool) bool {
+	if len(rules) == 0 {
+		return all
+	}
+	if !all {
+		for _, r := range rules {
+			if r.re.MatchString(row[r.cell]) {
+				return true
+			}
+		}
+		return false
+	}
+	// group the include rules by cell
+	matched := make(map[int]bool, len(rules))
+	for _, r := range rules {
+		if !matched[r.cell] {
+			matched[r.cell] = r.re.MatchString(row[r.cell])
+		}
+	}
+	for _, m := range matched {
+		if !m {
+			return false
+		}
+	}
+	return true
+}
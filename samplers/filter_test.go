@@ -0,0 +1,116 @@
+package samplers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob, want string
+	}{
+		{"loop*", `^loop.*$`},
+		{"sd?", `^sd.$`},
+		{"/data/*", `^/data/.*$`},
+		{"[!a-c]x", `^[^a-c]x$`},
+		{"a[b", `^a\[b$`},
+		{"1.5", `^1\.5$`},
+	}
+	for _, tt := range tests {
+		if got := globToRegexp(tt.glob); got != tt.want {
+			t.Errorf("globToRegexp(%q) = %q, want %q", tt.glob, got, tt.want)
+		}
+	}
+}
+
+type filterRow struct {
+	Name   string `column:"name,sort="`
+	Mount  string `column:"mount"`
+	Device string `column:"device"`
+}
+
+func TestParseFilterRules(t *testing.T) {
+	c := testView(t, filterRow{}).Columns()
+	tests := []struct {
+		spec    string
+		want    []string // column and regexp of each rule
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"mount=re:^/data", []string{"Mount", "^/data"}, false},
+		{" device = loop* ; ", []string{"Device", "^loop.*$"}, false},
+		{"Device=sd?", []string{"Device", "^sd.$"}, false},
+		{"root*", []string{"", "^root.*$"}, false},
+		{"re:^a=b", []string{"", "^a=b"}, false},
+		{"nosuch=x", []string{"", `^nosuch=x$`}, false},
+		{"'a;b';mount=/", []string{"", `^'a;b'$`, "Mount", "^/$"}, false},
+		{"mount=re:(", nil, true},
+	}
+	for _, tt := range tests {
+		rules, err := parseFilterRules(c, tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseFilterRules(%q): no error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFilterRules(%q): %v", tt.spec, err)
+			continue
+		}
+		var got []string
+		for _, r := range rules {
+			got = append(got, r.column, r.re.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFilterRules(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestRowFilter(t *testing.T) {
+	data := map[string]filterRow{
+		"a": {"a", "/", "sda1"},
+		"b": {"b", "/data/1", "sdb1"},
+		"c": {"c", "/data/2", "loop0"},
+		"d": {"d", "/snap/x", "loop1"},
+		"e": {"e", "/boot", "nvme0n1p1"},
+	}
+	tests := []struct {
+		include, exclude string
+		want             []string
+	}{
+		{"", "", []string{"a", "b", "c", "d", "e"}},
+		{"mount=re:^/data", "", []string{"b", "c"}},
+		{"mount=re:^/data", "device=loop*", []string{"b"}},
+		{"mount=/;mount=/boot", "", []string{"a", "e"}},
+		{"mount=re:^/data;device=sd*", "", []string{"b"}},
+		{"", "device=loop*;e", []string{"a", "b"}},
+		{"[ab]", "", []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		v := testView(t, filterRow{})
+		if err := v.SetRowFilter(tt.include, tt.exclude); err != nil {
+			t.Fatalf("SetRowFilter(%q, %q): %v", tt.include, tt.exclude, err)
+		}
+		rows, err := v.RowsFromMap(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range rows {
+			got = append(got, r[0])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SetRowFilter(%q, %q): rows %q, want %q", tt.include, tt.exclude, got, tt.want)
+		}
+	}
+	// rules name columns, so they are set first
+	var v View
+	if err := v.SetRowFilter("mount=/", ""); err == nil {
+		t.Error("SetRowFilter() before SetColumns(): no error")
+	}
+	if err := v.SetRowFilter("", ""); err != nil {
+		t.Errorf("SetRowFilter() of no rules before SetColumns(): %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// headlinetag is the struct tag key for headline options
+const headlinetag = "headline"
+
+// headlines holds the compiled layout of a headline struct and the values
+// last sent for each headline, so only changes are published
+type headlines struct {
+	typ   reflect.Type
+	enc   *encoder
+	names []string // headline name for each rendered cell
+	last  map[string]string
+}
+
+/*
+HeadlinesFromStruct publishes the fields of the struct data as headlines
+on the View. Fields are named and formatted by a "headline" tag that
+takes the same options as the "column" tag used by ColumnInfo(), e.g.
+
+	type Status struct {
+		OS      string    `headline:"os"`
+		Load    float64   `headline:"loadAverage,precision=2"`
+		Started time.Time `headline:"started,time=rfc3339"`
+		Scratch int       `headline:"OMIT"`
+	}
+
+Untagged fields use the field name and embedded structs are flattened.
+Channel and function fields can't be published and must be OMIT.
+Values are compared with those last published by this method and only
+changed headlines are sent. Headlines are created the first time they are
+seen.
+*/
+func (v *View) HeadlinesFromStruct(data interface{}) (err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("HeadlinesFromStruct(): %T is not a struct", data)
+	}
+	h := v.headlines
+	if h == nil || h.typ != rv.Type() {
+		if h, err = newHeadlines(rv.Type()); err != nil {
+			return
+		}
+		if v.headlines != nil {
+			// headlines already on the dataview don't change
+			h.last = v.headlines.last
+		}
+		v.headlines = h
+	}
+
+	h.enc.now = v.timeSource().Now()
+	cells, _, err := h.enc.render(rv)
+	if err != nil {
+		return
+	}
+	for i, value := range cells {
+		name := h.names[i]
+		last, ok := h.last[name]
+		switch {
+		case ok && last == value:
+			continue
+		case ok:
+			err = v.UpdateHeadline(name, value)
+		default:
+			// Headline() creates the headline if needed
+			err = v.Headline(name, value)
+		}
+		if err != nil {
+			return
+		}
+		h.last[name] = value
+	}
+	return
+}
+
+// ResetHeadlines forgets the values last published by
+// HeadlinesFromStruct() so that the next call sends them all again, for
+// example after the dataview has been recreated
+func (v *View) ResetHeadlines() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.headlines != nil {
+		v.headlines.last = make(map[string]string)
+	}
+}
+
+func newHeadlines(rt reflect.Type) (h *headlines, err error) {
+	fields, err := flattenFields(rt, headlinetag)
+	if err != nil {
+		return
+	}
+	columns := make(Columns, len(fields))
+	for i, f := range fields {
+		column := columndetails{}
+		if f.hastag {
+			if column, err = parseTags(f.name, f.tag); err != nil {
+				return
+			}
+			if column.rowname {
+				return nil, fmt.Errorf("headline field %q cannot be a rowname", f.key)
+			}
+		} else {
+			column.name = f.name
+			column.format = "%v"
+			column.precision = -1
+		}
+		column.number = i
+		column.expr = f.expr
+		if f.omit {
+			column.name = "OMIT"
+		}
+		if column.name != "OMIT" {
+			column.name = f.prefix + column.name
+			switch f.typ.Kind() {
+			case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+				return nil, fmt.Errorf("headline field %q: cannot publish a %v", f.key, f.typ)
+			}
+		}
+		columns[f.key] = column
+	}
+
+	enc, err := newEncoder(columns, rt, headlinetag)
+	if err != nil {
+		return
+	}
+	h = &headlines{
+		typ:   rt,
+		enc:   enc,
+		names: make([]string, enc.cells),
+		last:  make(map[string]string),
+	}
+	for _, f := range enc.fields {
+		if f.cell != -1 {
+			h.names[f.cell] = f.column.name
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package samplers_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/samplertest"
+)
+
+type zone struct {
+	Zone string `headline:"zone"`
+}
+
+type status struct {
+	OS      string    `headline:"os"`
+	Load    float64   `headline:"loadAverage,precision=2"`
+	Count   int       // untagged, named after the field
+	Started time.Time `headline:"started,time=2006-01-02"`
+	Scratch chan int  `headline:"OMIT"`
+	zone
+}
+
+// headlineCalls returns the headline calls made since the last call, as
+// method(name)
+func headlineCalls(calls []string) (methods []string) {
+	for _, c := range calls {
+		i := strings.IndexByte(c, '(')
+		m := c[strings.LastIndexByte(c[:i], '.')+1 : i]
+		if !strings.Contains(strings.ToLower(m), "headline") {
+			continue
+		}
+		name := strings.SplitN(c[i+1:len(c)-1], ", ", 2)[0]
+		methods = append(methods, m+"("+strings.Trim(name, `"`)+")")
+	}
+	return
+}
+
+func TestHeadlinesFromStruct(t *testing.T) {
+	n, p := newSampler(t)
+	started := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := status{OS: "linux", Load: 0.5, Count: 3, Started: started, zone: zone{"eu"}}
+	all := []string{"os", "loadAverage", "Count", "started", "zone"}
+	created := func() (calls []string) {
+		for _, name := range all {
+			calls = append(calls, "headlineExists("+name+")", "addHeadline("+name+")", "updateHeadline("+name+")")
+		}
+		return
+	}()
+
+	tests := []struct {
+		name   string
+		change func()
+		calls  []string
+		values map[string]string
+	}{
+		{"first publish", nil, created, map[string]string{
+			"os": "linux", "loadAverage": "0.50", "Count": "3", "started": "2024-03-01", "zone": "eu",
+		}},
+		{"unchanged", nil, nil, nil},
+		{"one change", func() { s.Load = 1.25 }, []string{"updateHeadline(loadAverage)"}, map[string]string{"loadAverage": "1.25"}},
+		{"two changes", func() { s.Count, s.Zone = 4, "us" }, []string{"updateHeadline(Count)", "updateHeadline(zone)"},
+			map[string]string{"Count": "4", "zone": "us"}},
+		// a change that doesn't change the rendered value isn't sent
+		{"same cell", func() { s.Load = 1.251 }, nil, nil},
+		{"reset", func() { p.ResetHeadlines() }, func() (calls []string) {
+			for _, name := range all {
+				calls = append(calls, "headlineExists("+name+")", "updateHeadline("+name+")")
+			}
+			return
+		}(), nil},
+	}
+	for _, tt := range tests {
+		if tt.change != nil {
+			tt.change()
+		}
+		n.Calls()
+		if err := p.HeadlinesFromStruct(s); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := headlineCalls(n.Calls()); !reflect.DeepEqual(got, tt.calls) {
+			t.Errorf("%s: calls %q, want %q", tt.name, got, tt.calls)
+		}
+		d, _ := n.Dataview(samplertest.Entity, samplertest.Sampler, "test", "SYSTEM")
+		for name, want := range tt.values {
+			if got, ok := d.Headline(name); !ok || got != want {
+				t.Errorf("%s: headline %s = %q, want %q", tt.name, name, got, want)
+			}
+		}
+	}
+	d, _ := n.Dataview(samplertest.Entity, samplertest.Sampler, "test", "SYSTEM")
+	if _, ok := d.Headline("Scratch"); ok {
+		t.Error("OMIT field published")
+	}
+}
+
+func TestHeadlinesFromStructErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+	}{
+		{"not a struct", 1},
+		{"nil pointer", (*status)(nil)},
+		{"channel", struct{ C chan int }{}},
+		{"function", struct {
+			F func() `headline:"f"`
+		}{}},
+		{"bad tag", struct {
+			N int `headline:"n,time=rfc3339"`
+		}{}},
+		{"row name", struct {
+			N string `headline:"n,rowname="`
+		}{}},
+		{"bad format", struct {
+			N string `headline:"n,format=%d"`
+		}{}},
+	}
+	for _, tt := range tests {
+		_, p := newSampler(t)
+		if err := p.HeadlinesFromStruct(tt.data); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// layout holds the settings used to render rows of data into a table.
+// It is shared by View and Table so both render data the same way. It
+// must not be copied, which go vet reports because of mu.
+type layout struct {
+	// mu guards everything below and is held for the whole of a table
+	// update so that the settings can be changed from other goroutines
+	mu sync.Mutex
+
+	columns     Columns
+	columnnames []string
+	sortcolumn  string
+	encoders    *encoders
+	keyrownames bool
+
+	sortorder      []sortKey // set at runtime, overrides the tags if not nil
+	sortparam      string    // sampler parameter holding a sort order
+	sortparamvalue string    // the last value of sortparam applied
+
+	computedparam      string   // sampler parameter holding computed columns
+	computedparamvalue string   // the last value of computedparam applied
+	paramcomputed      []string // the columns added from computedparam
+
+	summaryname string
+	summarypos  SummaryPosition
+
+	rowlimit  int
+	othername string
+	counts    *rowCounts // set by SetRowLimit()
+
+	filter            *rowFilter
+	filterparams      [2]string // sampler parameters holding include and exclude rules
+	filterparamvalues [2]string // the last values of filterparams applied
+
+	paramsread time.Time // when the parameters above were read, zero to read them on the next refresh
+
+	rowstate *rowState // set by SetRowPolicy() or SetRowEvents()
+	windows  *windows  // the rings of window columns, created on the first update
+
+	clock Clock // set by SetClock(), SystemClock if nil
+}
+
+// DuplicateRowsError is returned when more than one row in an update has
+// the same row name. Geneos dataviews require unique row names.
+type DuplicateRowsError struct {
+	Names []string
+}
+
+func (e *DuplicateRowsError) Error() string {
+	return fmt.Sprintf("duplicate row names: %s", strings.Join(e.Names, ", "))
+}
+
+// SetClock sets the Clock used for row grace and expiry periods and
+// "age" time columns, for tests. The default is SystemClock.
+func (l *layout) SetClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock
+}
+
+func (l *layout) Clock() Clock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.timeSource()
+}
+
+// timeSource returns the Clock to use. The caller holds the lock
+func (l *layout) timeSource() Clock {
+	if l.clock == nil {
+		return SystemClock
+	}
+	return l.clock
+}
+
+// encoderCache returns the encoders for the current Columns, made by
+// SetColumns() so they are kept between updates
+func (l *layout) encoderCache() *encoders {
+	if l.encoders == nil {
+		return newEncoders(l.columns)
+	}
+	return l.encoders
+}
+
+func (l *layout) rowsFromMap(r reflect.Value, update bool) (rows [][]string, err error) {
+	r = reflect.Indirect(r)
+	if r.Kind() != reflect.Map {
+		err = fmt.Errorf("non Map passed")
+		return
+	}
+	enc, err := l.encoderCache().forType(r.Type().Elem())
+	if err != nil {
+		return
+	}
+	enc.now = l.timeSource().Now()
+
+	rows = make([][]string, 0, r.Len())
+	var vals [][]interface{}
+	iter := r.MapRange()
+	for iter.Next() {
+		cells, v, err := enc.render(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if l.keyrownames {
+			cells[0] = renderPlain(iter.Key())
+		}
+		rows = append(rows, cells)
+		if v != nil {
+			vals = append(vals, v)
+		}
+	}
+
+	return l.finish(enc, rows, vals, true, update)
+}
+
+func (l *layout) rowsFromSlice(rd reflect.Value, update bool) (rows [][]string, err error) {
+	rd = reflect.Indirect(rd)
+	if rd.Kind() != reflect.Slice {
+		err = fmt.Errorf("non Slice passed")
+		return
+	}
+	enc, err := l.encoderCache().forType(rd.Type().Elem())
+	if err != nil {
+		return
+	}
+	enc.now = l.timeSource().Now()
+
+	rows = make([][]string, 0, rd.Len())
+	var vals [][]interface{}
+	for i := 0; i < rd.Len(); i++ {
+		cells, v, err := enc.render(rd.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, cells)
+		if v != nil {
+			vals = append(vals, v)
+		}
+	}
+
+	// slices are already in the order wanted
+	return l.finish(enc, rows, vals, false, update)
+}
+
+func (l *layout) rowsFromMapDelta(rnew, rold reflect.Value,
+	interval time.Duration, update bool) (rows [][]string, err error) {
+
+	// if no interval is supplied - the same as an interval of zero
+	// then set 1 second as the interval as the divisor below takes
+	// the number of seconds as the value, hence cancelling itself out
+	if interval == 0 {
+		interval = 1 * time.Second
+	}
+
+	rnew = reflect.Indirect(rnew)
+	if rnew.Kind() != reflect.Map {
+		err = fmt.Errorf("non map passed")
+		return
+	}
+
+	rold = reflect.Indirect(rold)
+	if rold.Kind() != reflect.Map {
+		err = fmt.Errorf("non map passed")
+		return
+	}
+
+	if rnew.Type() != rold.Type() {
+		err = fmt.Errorf("non-matching types in data")
+		return
+	}
+
+	enc, err := l.encoderCache().forType(rnew.Type().Elem())
+	if err != nil {
+		return
+	}
+	enc.now = l.timeSource().Now()
+
+	rows = make([][]string, 0, rnew.Len())
+	var vals [][]interface{}
+	seconds := interval.Seconds()
+	iter := rnew.MapRange()
+	for iter.Next() {
+		cells, v, err := enc.renderDelta(iter.Value(), rold.MapIndex(iter.Key()), seconds)
+		if err != nil {
+			return nil, err
+		}
+		if l.keyrownames {
+			cells[0] = renderPlain(iter.Key())
+		}
+		rows = append(rows, cells)
+		if v != nil {
+			vals = append(vals, v)
+		}
+	}
+
+	return l.finish(enc, rows, vals, true, update)
+}
+
+// finish applies the steps that follow rendering the rows: checking the
+// row names are unique, applying windows, filtering, sorting, if sorted is
+// true, truncating to the row limit and adding the summary row, if any. vals
+// are the values of each row, if the encoder collects them, for the windows
+// and the summary and roll-up rows. update is true if the rows are to be
+// published, which moves the windows on.
+func (l *layout) finish(enc *encoder, rows [][]string, vals [][]interface{}, sorted, update bool) (_ [][]string, err error) {
+	if err = checkRowNames(rows); err != nil {
+		return
+	}
+	if enc.windowed {
+		if err = l.applyWindows(enc, rows, vals, update); err != nil {
+			return
+		}
+	}
+	rows, vals = l.filterRows(enc, rows, vals)
+	if sorted {
+		rows, vals = enc.sortRows(rows, vals, l.sortKeys())
+	}
+	var sum *summary
+	if enc.summaries && l.summarypos != SummaryNone {
+		sum = newSummary(enc, vals)
+	}
+	truncated := l.rowlimit > 0 && len(rows) > l.rowlimit
+	if rows, err = l.truncate(enc, rows, vals); err != nil {
+		return
+	}
+	if rows, err = l.addSummary(rows, sum); err != nil {
+		return
+	}
+	// the roll-up and summary row names must not clash with the others
+	if truncated || sum != nil {
+		if err = checkRowNames(rows); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// checkRowNames returns a *DuplicateRowsError if any row names, the
+// first cell of each row, are repeated
+func checkRowNames(rows [][]string) error {
+	seen := make(map[string]int, len(rows))
+	var dups []string
+	for _, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		seen[row[0]]++
+		if seen[row[0]] == 2 {
+			dups = append(dups, row[0])
+		}
+	}
+	if len(dups) > 0 {
+		sort.Strings(dups)
+		return &DuplicateRowsError{Names: dups}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"wonderland.org/geneos/streams"
+	"wonderland.org/geneos/xmlrpc"
+)
+
+// RowPolicy controls what happens to rows in a dataview over time. The
+// zero value is the default behaviour, the whole table is replaced on
+// each update so rows missing from a sample vanish straight away.
+type RowPolicy struct {
+	// Grace is how long a row missing from the samples is kept, with its
+	// last values, before it is removed. Zero removes it at once.
+	Grace time.Duration
+
+	// TTL expires a row that has not been updated for this long, whether
+	// it is still in the samples with the same values or is missing and
+	// kept by Grace. An expired row is taken out of the dataview and
+	// added again when its values change or it comes back after being
+	// missing. Zero turns expiry off.
+	TTL time.Duration
+
+	// Incremental sends only the rows that have been added, changed or
+	// removed since the last update, rather than the whole table. The
+	// whole table is still sent the first time, when the columns change
+	// and when a new row does not come after the existing ones in the
+	// update, as AddRow() can only append. Existing rows are not moved.
+	Incremental bool
+}
+
+// rowState tracks the rows published to a dataview between updates
+type rowState struct {
+	policy    RowPolicy
+	events    *streams.Stream
+	rows      map[string]*rowEntry
+	columns   string // the column names last published, joined
+	published bool   // false forces the next incremental update to send the whole table
+}
+
+type rowEntry struct {
+	cells   []string
+	seen    time.Time // the last time the row was in a sample
+	updated time.Time // the last time the row was added or changed
+	missing bool      // not in the last sample
+	expired bool      // removed by the TTL, sent again when updated
+}
+
+/*
+SetRowPolicy sets how rows are added, kept and removed by the table
+update methods. For example, to only send changes, keep rows for an
+hour after they stop appearing and take rows out of the dataview when
+they have not changed for five minutes:
+
+	p.SetRowPolicy(samplers.RowPolicy{
+		Grace:       time.Hour,
+		TTL:         5 * time.Minute,
+		Incremental: true,
+	})
+*/
+func (l *layout) SetRowPolicy(policy RowPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.initRowState()
+	l.rowstate.policy = policy
+	l.rowstate.published = false
+}
+
+// RowPolicy returns the current row policy
+func (l *layout) RowPolicy() RowPolicy {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rowstate == nil {
+		return RowPolicy{}
+	}
+	return l.rowstate.policy
+}
+
+// SetRowEvents sets an optional stream that gets a message each time the
+// table update methods add, remove or expire a row. The stream name must
+// already have been set using SetStreamName(). A nil stream turns the
+// messages off.
+func (l *layout) SetRowEvents(stream *streams.Stream) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.initRowState()
+	l.rowstate.events = stream
+}
+
+func (l *layout) initRowState() {
+	if l.rowstate == nil {
+		l.rowstate = &rowState{rows: make(map[string]*rowEntry)}
+	}
+}
+
+// publish sends rows to d according to the row policy. Rows inside the
+// grace period are kept with their last values, after the other rows.
+func (s *rowState) publish(d *xmlrpc.Dataview, columns []string, rows [][]string, now time.Time) (err error) {
+	current := make(map[string]bool, len(rows))
+	var added, returned, changed []string
+	for _, row := range rows {
+		name := row[0]
+		current[name] = true
+		e, ok := s.rows[name]
+		switch {
+		case !ok:
+			e = &rowEntry{}
+			s.rows[name] = e
+			added = append(added, name)
+		case e.expired && (e.missing || !equalCells(e.cells, row)):
+			e.expired = false
+			returned = append(returned, name)
+		case e.expired || equalCells(e.cells, row):
+			e.seen, e.missing = now, false
+			continue
+		default:
+			changed = append(changed, name)
+		}
+		e.cells, e.seen, e.updated, e.missing = row, now, now, false
+	}
+
+	var removed []string
+	for name, e := range s.rows {
+		if current[name] {
+			continue
+		}
+		e.missing = true
+		if s.policy.Grace > 0 && now.Sub(e.seen) < s.policy.Grace {
+			continue
+		}
+		delete(s.rows, name)
+		if !e.expired {
+			removed = append(removed, name)
+		}
+	}
+	expired := s.expire(d, now)
+
+	// the rows to publish, in order, and the missing rows kept by Grace
+	var table [][]string
+	var kept []string
+	for _, row := range rows {
+		if !s.rows[row[0]].expired {
+			table = append(table, row)
+		}
+	}
+	for name, e := range s.rows {
+		if e.missing && !e.expired {
+			kept = append(kept, name)
+		}
+	}
+	// map order is random, keep the rows in the same order each time
+	sort.Strings(kept)
+	sort.Strings(removed)
+	sort.Strings(expired)
+	// AddRow() appends, so rows that sort before existing ones need the
+	// whole table to be sent
+	inorder := s.inorder(table, append(added, returned...))
+
+	cols := strings.Join(columns, "\x00")
+	if !s.policy.Incremental || !s.published || cols != s.columns || !inorder {
+		for _, name := range kept {
+			table = append(table, s.rows[name].cells)
+		}
+		if err = d.UpdateTable(columns, table...); err != nil {
+			s.published = false
+			return
+		}
+		s.columns, s.published = cols, true
+	} else if err = s.update(d, append(added, returned...), changed, append(removed, expired...)); err != nil {
+		// the dataview no longer matches, send it all next time
+		s.published = false
+		return
+	}
+
+	for _, name := range append(added, returned...) {
+		s.event("added row %q", name)
+	}
+	for _, name := range removed {
+		s.event("removed row %q", name)
+	}
+	for _, name := range expired {
+		s.event("expired row %q", name)
+	}
+	return
+}
+
+// expire marks the rows that have not been updated for the TTL as
+// expired and returns their names. With Incremental the Netprobe is asked
+// for them using RowNamesOlderThan(), as only changed rows are sent to
+// it. Otherwise the whole table is sent each time, which updates every
+// row, so the times kept here are used.
+func (s *rowState) expire(d *xmlrpc.Dataview, now time.Time) (expired []string) {
+	if s.policy.TTL <= 0 {
+		return
+	}
+	cutoff := now.Add(-s.policy.TTL)
+	var names []string
+	if s.policy.Incremental && s.published {
+		var err error
+		if names, err = d.RowNamesOlderThan(cutoff.Unix()); err != nil {
+			// already logged, try again next time
+			return
+		}
+	} else {
+		for name := range s.rows {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		e, ok := s.rows[name]
+		// rows added or changed in this update are not stale
+		if !ok || e.expired || !e.updated.Before(cutoff) {
+			continue
+		}
+		e.expired = true
+		expired = append(expired, name)
+	}
+	return
+}
+
+// inorder returns true if the rows in names, the new rows of the
+// dataview, are all at the end of table
+func (s *rowState) inorder(table [][]string, names []string) bool {
+	if len(names) > len(table) {
+		return false
+	}
+	tail := make(map[string]bool, len(names))
+	for _, row := range table[len(table)-len(names):] {
+		tail[row[0]] = true
+	}
+	for _, name := range names {
+		if !tail[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// update sends the added, changed and removed rows one at a time
+func (s *rowState) update(d *xmlrpc.Dataview, added, changed, removed []string) (err error) {
+	for _, name := range added {
+		if err = d.AddRow(name); err != nil {
+			return
+		}
+		if err = updateRow(d, s.rows[name].cells); err != nil {
+			return
+		}
+	}
+	for _, name := range changed {
+		if err = updateRow(d, s.rows[name].cells); err != nil {
+			return
+		}
+	}
+	for _, name := range removed {
+		if err = d.RemoveRow(name); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// event writes a message to the row events stream, if set
+func (s *rowState) event(format string, args ...interface{}) {
+	if s.events == nil {
+		return
+	}
+	if _, err := s.events.WriteString(fmt.Sprintf(format, args...)); err != nil {
+		ErrorLogger.Print(err)
+	}
+}
+
+// updateRow sends the cells of a row, without the row name
+func updateRow(d *xmlrpc.Dataview, row []string) error {
+	args := make([]interface{}, len(row)-1)
+	for i, c := range row[1:] {
+		args[i] = c
+	}
+	return d.UpdateRow(row[0], args...)
+}
+
+func equalCells(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package samplers_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/samplers"
+	"wonderland.org/geneos/samplertest"
+	"wonderland.org/geneos/streams"
+)
+
+type lifeRow struct {
+	Name  string `column:"name,sort="`
+	Value int    `column:"value"`
+}
+
+// tableCalls returns the methods of the table update calls made since
+// the last call
+func tableCalls(n *samplertest.Netprobe) (methods []string) {
+	for _, c := range n.Calls() {
+		m := c[:strings.IndexByte(c, '(')]
+		m = m[strings.LastIndexByte(m, '.')+1:]
+		switch m {
+		case "updateEntireTable", "addTableRow", "updateTableRow", "removeTableRow":
+			methods = append(methods, m)
+		}
+	}
+	return
+}
+
+func TestRowPolicy(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		data    map[string]int
+		rows    string   // rows in the dataview, as name=value
+		calls   []string // table update methods
+		events  []string
+	}
+	tests := []struct {
+		name   string
+		policy samplers.RowPolicy
+		steps  []step
+	}{
+		{
+			name: "default",
+			steps: []step{
+				{0, map[string]int{"a": 1, "b": 2}, "a=1 b=2", []string{"updateEntireTable"}, []string{`added row "a"`, `added row "b"`}},
+				{time.Minute, map[string]int{"b": 2}, "b=2", []string{"updateEntireTable"}, []string{`removed row "a"`}},
+			},
+		},
+		{
+			name:   "grace and TTL",
+			policy: samplers.RowPolicy{Grace: 10 * time.Minute, TTL: 3 * time.Minute},
+			steps: []step{
+				{0, map[string]int{"a": 1, "b": 2}, "a=1 b=2", []string{"updateEntireTable"}, []string{`added row "a"`, `added row "b"`}},
+				{2 * time.Minute, map[string]int{"b": 2}, "b=2 a=1", []string{"updateEntireTable"}, nil},
+				// a has not been updated for the TTL, b has changed
+				{2 * time.Minute, map[string]int{"b": 3}, "b=3", []string{"updateEntireTable"}, []string{`expired row "a"`}},
+				// back after expiry, so added again
+				{time.Minute, map[string]int{"a": 1, "b": 3}, "a=1 b=3", []string{"updateEntireTable"}, []string{`added row "a"`}},
+				// b is still in the samples but hasn't changed for the TTL
+				{3 * time.Minute, map[string]int{"a": 2, "b": 3}, "a=2", []string{"updateEntireTable"}, []string{`expired row "b"`}},
+				{time.Minute, map[string]int{"a": 2, "b": 3}, "a=2", []string{"updateEntireTable"}, nil},
+				{time.Minute, map[string]int{"a": 2, "b": 4}, "a=2 b=4", []string{"updateEntireTable"}, []string{`added row "b"`}},
+				{time.Minute, map[string]int{"a": 3}, "a=3 b=4", []string{"updateEntireTable"}, nil},
+				// b has been missing for longer than the grace period
+				{10 * time.Minute, map[string]int{"a": 4}, "a=4", []string{"updateEntireTable"}, []string{`removed row "b"`}},
+			},
+		},
+		{
+			name:   "incremental",
+			policy: samplers.RowPolicy{Grace: 10 * time.Minute, TTL: 3 * time.Minute, Incremental: true},
+			steps: []step{
+				{0, map[string]int{"b": 1, "c": 2}, "b=1 c=2", []string{"updateEntireTable"}, []string{`added row "b"`, `added row "c"`}},
+				{time.Minute, map[string]int{"b": 1, "c": 3}, "b=1 c=3", []string{"updateTableRow"}, nil},
+				{time.Minute, map[string]int{"b": 1, "c": 3, "d": 4}, "b=1 c=3 d=4", []string{"addTableRow", "updateTableRow"}, []string{`added row "d"`}},
+				// a new row that sorts first needs the whole table
+				{time.Minute, map[string]int{"a": 0, "b": 1, "c": 3, "d": 4}, "a=0 b=1 c=3 d=4", []string{"updateEntireTable"}, []string{`added row "a"`}},
+				{time.Minute, map[string]int{"a": 0, "b": 1, "c": 3}, "a=0 b=1 c=3 d=4", nil, nil},
+				// the Netprobe has had no update of a, b or d for the TTL
+				{3 * time.Minute, map[string]int{"a": 0, "b": 1, "c": 4}, "c=4", []string{"updateTableRow", "removeTableRow", "removeTableRow", "removeTableRow"},
+					[]string{`expired row "a"`, `expired row "b"`, `expired row "d"`}},
+				// b has changed and d is back, a is unchanged so stays out
+				{time.Minute, map[string]int{"a": 0, "b": 2, "c": 4, "d": 4}, "b=2 c=4 d=4", []string{"updateEntireTable"}, []string{`added row "b"`, `added row "d"`}},
+				{time.Minute, map[string]int{"a": 1, "b": 2, "c": 4, "d": 4}, "a=1 b=2 c=4 d=4", []string{"updateEntireTable"}, []string{`added row "a"`}},
+				{time.Minute, map[string]int{"a": 1, "b": 2, "c": 4, "d": 4, "e": 5}, "a=1 b=2 c=4 d=4 e=5", []string{"addTableRow", "updateTableRow"}, []string{`added row "e"`}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, p := newSampler(t)
+			clock := n.Clock()
+			c, names, sortcol, err := p.ColumnInfo(lifeRow{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.SetColumns(c)
+			p.SetColumnNames(names)
+			p.SetSortColumn(sortcol)
+			if tt.policy != (samplers.RowPolicy{}) {
+				p.SetRowPolicy(tt.policy)
+			}
+			events, err := streams.Sampler(samplertest.URL, samplertest.Entity, samplertest.Sampler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			events.Transport = n
+			events.SetStreamName("rows")
+			p.SetRowEvents(&events)
+
+			var seen int
+			for i, s := range tt.steps {
+				clock.Advance(s.advance)
+				data := make(map[string]lifeRow, len(s.data))
+				for name, value := range s.data {
+					data[name] = lifeRow{name, value}
+				}
+				if err = p.UpdateTableFromMap(data); err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if got := tableCalls(n); !reflect.DeepEqual(got, s.calls) {
+					t.Errorf("step %d: calls %q, want %q", i, got, s.calls)
+				}
+				d, _ := n.Dataview(samplertest.Entity, samplertest.Sampler, "test", "SYSTEM")
+				var rows []string
+				for _, r := range d.RowNames() {
+					rows = append(rows, r+"="+d.Row(r)[1])
+				}
+				if got := strings.Join(rows, " "); got != s.rows {
+					t.Errorf("step %d: rows %q, want %q", i, got, s.rows)
+				}
+				all := n.Stream(samplertest.Entity, samplertest.Sampler, "rows")
+				if got := all[seen:]; !reflect.DeepEqual(got, s.events) && (len(got) != 0 || s.events != nil) {
+					t.Errorf("step %d: events %q, want %q", i, got, s.events)
+				}
+				seen = len(all)
+			}
+		})
+	}
+}
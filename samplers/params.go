@@ -0,0 +1,184 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultParameterRefresh is how often bound parameters are read again
+// unless changed with SetParameterRefresh()
+const DefaultParameterRefresh = 1 * time.Minute
+
+// boundParameters is the configuration struct bound by BindParameters()
+// and the state of its refresh. The fields are guarded by the Samplers
+// mutex, loading is serialised by loading.
+type boundParameters struct {
+	loading   sync.Mutex
+	cfg       reflect.Value // pointer to the struct
+	refresh   *time.Duration
+	last      time.Time
+	callbacks []func(changed []string)
+}
+
+/*
+BindParameters reads the sampler parameters named in the param tags of
+the struct pointed to by cfg, see xmlrpc.LoadParameters() for the tags,
+and keeps it up to date. Usually called once from InitSampler():
+
+	type Config struct {
+		URL     string        `param:"POWERWALL_URL,required"`
+		Timeout time.Duration `param:"TIMEOUT,default=10s"`
+	}
+
+	func (p *PowerwallSampler) InitSampler() error {
+		return p.BindParameters(&p.config)
+	}
+
+The parameters are read again, in the sampler goroutine, before
+DoSample() once the refresh interval has passed, DefaultParameterRefresh
+unless changed with SetParameterRefresh(), so changes to the Gateway
+setup are picked up without a restart. The struct is only updated, and
+the functions added with OnParameterChange() called, when a value has
+changed and all the parameters are valid. Errors during a refresh are
+logged and leave the struct as it was.
+*/
+func (p *Samplers) BindParameters(cfg interface{}) (err error) {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("BindParameters(): not a pointer to a struct")
+	}
+	if err = p.LoadParameters(cfg); err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := p.boundParameters()
+	b.cfg = rv
+	b.last = p.timeSource().Now()
+	return
+}
+
+// boundParameters returns the bound parameters state, creating it if
+// needed. The caller must hold p.mu
+func (p *Samplers) boundParameters() *boundParameters {
+	if p.params == nil {
+		p.params = &boundParameters{}
+	}
+	return p.params
+}
+
+// SetParameterRefresh sets how often bound parameters, and the sort,
+// filter and computed column parameters of the views, are read again.
+// Zero turns off the refresh, RefreshParameters() can still be called.
+func (p *Samplers) SetParameterRefresh(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.boundParameters().refresh = &interval
+}
+
+// ParameterRefresh returns the refresh interval of bound parameters
+func (p *Samplers) ParameterRefresh() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.parameterRefresh()
+}
+
+func (p *Samplers) parameterRefresh() time.Duration {
+	if p.params == nil || p.params.refresh == nil {
+		return DefaultParameterRefresh
+	}
+	return *p.params.refresh
+}
+
+// OnParameterChange adds a function that is called, from the sampler's
+// goroutine before DoSample(), when a refresh changes bound parameters.
+// changed holds the names of the parameters that changed.
+func (p *Samplers) OnParameterChange(f func(changed []string)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b := p.boundParameters()
+	b.callbacks = append(b.callbacks, f)
+}
+
+// RefreshParameters reads the bound parameters now, updates the struct
+// and calls the change functions if any have changed, and returns the
+// names of those that changed. As it writes to the struct without a lock
+// it must only be called from InitSampler() or DoSample(), where the
+// plugin reads it.
+func (p *Samplers) RefreshParameters() (changed []string, err error) {
+	p.mu.Lock()
+	b := p.params
+	if b == nil || !b.cfg.IsValid() {
+		p.mu.Unlock()
+		return
+	}
+	b.last = p.timeSource().Now()
+	cfg := b.cfg
+	callbacks := append([]func([]string){}, b.callbacks...)
+	p.mu.Unlock()
+
+	// the callbacks are called without p.mu held so they can use the
+	// sampler, but still one refresh at a time
+	b.loading.Lock()
+	defer b.loading.Unlock()
+
+	// load into a copy so a bad value leaves the current config alone
+	cur := cfg.Elem()
+	n := reflect.New(cur.Type())
+	n.Elem().Set(cur)
+	if err = p.LoadParameters(n.Interface()); err != nil {
+		return
+	}
+	rt := cur.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag, ok := f.Tag.Lookup("param")
+		if !ok || tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		if !reflect.DeepEqual(cur.Field(i).Interface(), n.Elem().Field(i).Interface()) {
+			name := strings.TrimSpace(strings.SplitN(tag, ",", 2)[0])
+			if name == "" {
+				name = f.Name
+			}
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	cur.Set(n.Elem())
+	for _, f := range callbacks {
+		f(changed)
+	}
+	return
+}
+
+// refreshParametersDue refreshes bound parameters, and those of the
+// views, if the refresh interval has passed. Errors are logged so that a
+// bad parameter doesn't stop the sampler.
+func (p *Samplers) refreshParametersDue() {
+	p.mu.Lock()
+	refresh := p.parameterRefresh()
+	due := p.params != nil && p.params.cfg.IsValid() &&
+		refresh > 0 && p.timeSource().Since(p.params.last) >= refresh
+	views := append([]*View{}, p.views...)
+	p.mu.Unlock()
+	for _, v := range views {
+		v.refreshParameters(refresh)
+	}
+	if !due {
+		return
+	}
+	changed, err := p.RefreshParameters()
+	if err != nil {
+		ErrorLogger.Printf("sampler %q parameters: %v", p.ToString(), err)
+		return
+	}
+	if len(changed) > 0 {
+		Logger.Printf("sampler %q parameters changed: %s", p.ToString(), strings.Join(changed, ", "))
+	}
+}
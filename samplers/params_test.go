@@ -0,0 +1,245 @@
+package samplers_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/samplers"
+	"wonderland.org/geneos/samplertest"
+)
+
+type paramRow struct {
+	Name string  `column:"name,sort="`
+	Load float64 `column:"load"`
+}
+
+// newSampler returns a sampler, not started, on a new Netprobe
+func newSampler(t *testing.T) (n *samplertest.Netprobe, p *panicky) {
+	t.Helper()
+	n = samplertest.NewNetprobe()
+	conn, err := n.Connection(samplertest.Entity, samplertest.Sampler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = &panicky{}
+	p.Plugins = p
+	if err = p.New(conn, "test", "SYSTEM"); err != nil {
+		t.Fatal(err)
+	}
+	p.SetClock(n.Clock())
+	return
+}
+
+// getParameters returns the parameters read since the last call
+func getParameters(n *samplertest.Netprobe) (names []string) {
+	for _, c := range n.Calls() {
+		if i := strings.Index(c, ".getParameter("); i != -1 {
+			names = append(names, strings.Trim(c[i+len(".getParameter("):len(c)-1], `"`))
+		}
+	}
+	return
+}
+
+func TestViewParameters(t *testing.T) {
+	n, p := newSampler(t)
+	clock := n.Clock()
+	c, names, sortcol, err := p.ColumnInfo(paramRow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetColumns(c)
+	p.SetColumnNames(names)
+	p.SetSortColumn(sortcol)
+	p.SetSortParameter("SORT")
+	p.SetFilterParameters("", "EXCLUDE")
+	table, err := samplers.NewTable[paramRow](p.View)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table.SetSortParameter("TABLESORT")
+	data := map[string]paramRow{"a": {"a", 3}, "b": {"b", 1}, "c": {"c", 2}}
+
+	tests := []struct {
+		advance   time.Duration
+		params    map[string]string
+		wantRead  []string
+		wantView  []string
+		wantTable []string
+	}{
+		{0, map[string]string{"SORT": "-load", "EXCLUDE": "c", "TABLESORT": "load"},
+			[]string{"EXCLUDE", "SORT", "TABLESORT"}, []string{"a", "b"}, []string{"b", "c", "a"}},
+		// not read again until the refresh interval has passed
+		{30 * time.Second, map[string]string{"SORT": "name", "EXCLUDE": ""},
+			nil, []string{"a", "b"}, []string{"b", "c", "a"}},
+		{30 * time.Second, nil,
+			[]string{"EXCLUDE", "SORT", "TABLESORT"}, []string{"a", "b", "c"}, []string{"b", "c", "a"}},
+		// a bad value leaves the order as it was
+		{time.Minute, map[string]string{"SORT": "nosuch"},
+			[]string{"EXCLUDE", "SORT", "TABLESORT"}, []string{"a", "b", "c"}, []string{"b", "c", "a"}},
+	}
+	for i, tt := range tests {
+		clock.Advance(tt.advance)
+		for name, value := range tt.params {
+			n.SetParameter(name, value)
+		}
+		if err = p.Sample(); err != nil {
+			t.Fatal(err)
+		}
+		if got := getParameters(n); !reflect.DeepEqual(got, tt.wantRead) {
+			t.Errorf("step %d: parameters read %q, want %q", i, got, tt.wantRead)
+		}
+		rows, err := p.RowsFromMap(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := firstCells(rows); !reflect.DeepEqual(got, tt.wantView) {
+			t.Errorf("step %d: view rows %q, want %q", i, got, tt.wantView)
+		}
+		if rows, err = samplers.RowsFromMap(table, data); err != nil {
+			t.Fatal(err)
+		}
+		if got := firstCells(rows); !reflect.DeepEqual(got, tt.wantTable) {
+			t.Errorf("step %d: table rows %q, want %q", i, got, tt.wantTable)
+		}
+		// updates don't read parameters
+		if err = p.UpdateTableFromMap(data); err != nil {
+			t.Fatal(err)
+		}
+		if got := getParameters(n); got != nil {
+			t.Errorf("step %d: update read %q", i, got)
+		}
+	}
+
+	// renaming a parameter reads it on the next sample
+	p.SetSortParameter("SORT2")
+	if err = p.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := getParameters(n), []string{"EXCLUDE", "SORT2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after rename: parameters read %q, want %q", got, want)
+	}
+}
+
+func firstCells(rows [][]string) (cells []string) {
+	for _, r := range rows {
+		cells = append(cells, r[0])
+	}
+	return
+}
+
+type boundConfig struct {
+	Mounts  []string      `param:"MOUNTS,default=/"`
+	Timeout time.Duration `param:"TIMEOUT,default=10s"`
+	Limit   int           `param:"LIMIT"`
+}
+
+func TestBindParameters(t *testing.T) {
+	n, p := newSampler(t)
+	clock := n.Clock()
+	var cfg boundConfig
+	if err := p.BindParameters(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := boundConfig{[]string{"/"}, 10 * time.Second, 0}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("BindParameters(): %+v, want %+v", cfg, want)
+	}
+	var changes [][]string
+	p.OnParameterChange(func(changed []string) { changes = append(changes, changed) })
+
+	tests := []struct {
+		advance time.Duration
+		params  map[string]string
+		want    boundConfig
+		changed []string // nil if no change functions called
+	}{
+		// not read until the refresh interval has passed
+		{30 * time.Second, map[string]string{"LIMIT": "5"}, want, nil},
+		{30 * time.Second, nil, boundConfig{[]string{"/"}, 10 * time.Second, 5}, []string{"LIMIT"}},
+		// one bad value leaves them all as they were
+		{time.Minute, map[string]string{"MOUNTS": "/,/var", "TIMEOUT": "soon"}, boundConfig{[]string{"/"}, 10 * time.Second, 5}, nil},
+		{time.Minute, map[string]string{"TIMEOUT": "5"}, boundConfig{[]string{"/", "/var"}, 5 * time.Second, 5}, []string{"MOUNTS", "TIMEOUT"}},
+		{time.Minute, nil, boundConfig{[]string{"/", "/var"}, 5 * time.Second, 5}, nil},
+	}
+	for i, tt := range tests {
+		clock.Advance(tt.advance)
+		for name, value := range tt.params {
+			n.SetParameter(name, value)
+		}
+		changes = nil
+		if err := p.Sample(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(cfg, tt.want) {
+			t.Errorf("step %d: %+v, want %+v", i, cfg, tt.want)
+		}
+		var changed []string
+		if len(changes) > 0 {
+			changed = changes[0]
+		}
+		if len(changes) > 1 || !reflect.DeepEqual(changed, tt.changed) {
+			t.Errorf("step %d: changes %q, want %q", i, changes, tt.changed)
+		}
+	}
+
+	p.SetParameterRefresh(0)
+	n.SetParameter("LIMIT", "6")
+	clock.Advance(time.Hour)
+	if p.Sample(); cfg.Limit != 5 {
+		t.Errorf("refresh off: Limit = %d", cfg.Limit)
+	}
+	if changed, err := p.RefreshParameters(); err != nil || cfg.Limit != 6 || !reflect.DeepEqual(changed, []string{"LIMIT"}) {
+		t.Errorf("RefreshParameters() = %q, %v, Limit %d", changed, err, cfg.Limit)
+	}
+}
+
+// reader reads its bound config in DoSample(), for the race detector
+type reader struct {
+	panicky
+	cfg   boundConfig
+	limit chan int
+}
+
+func (r *reader) DoSample() error {
+	r.limit <- r.cfg.Limit
+	return nil
+}
+
+// the bound struct is only written in the sampler goroutine
+func TestBindParametersRunning(t *testing.T) {
+	n := samplertest.NewNetprobe()
+	conn, err := n.Connection(samplertest.Entity, samplertest.Sampler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &reader{limit: make(chan int)}
+	r.Plugins = r
+	if err = r.New(conn, "test", "SYSTEM"); err != nil {
+		t.Fatal(err)
+	}
+	clock := n.Clock()
+	r.SetClock(clock)
+	r.SetInterval(10 * time.Second)
+	r.SetParameterRefresh(10 * time.Second)
+	if err = r.BindParameters(&r.cfg); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	if err = r.Start(&wg); err != nil {
+		t.Fatal(err)
+	}
+	defer wg.Wait()
+	defer r.Stop()
+	for i := 1; i <= 3; i++ {
+		n.SetParameter("LIMIT", strconv.Itoa(i))
+		clock.BlockUntil(1)
+		clock.Advance(10 * time.Second)
+		if got := <-r.limit; got != i {
+			t.Errorf("DoSample() %d: Limit = %d", i, got)
+		}
+	}
+}
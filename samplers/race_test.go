@@ -0,0 +1,162 @@
+package samplers_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/samplers"
+	"wonderland.org/geneos/samplertest"
+)
+
+type raceRow struct {
+	Name  string  `column:"name,sort=nat"`
+	Used  int     `column:"used,summary=sum"`
+	Total int     `column:"total"`
+	Load  float64 `column:"load,window=avg:5"`
+}
+
+type raceHeadlines struct {
+	Rows    int
+	Updated string
+}
+
+// racer updates its default view from DoSample() while the tests below
+// use the sampler from other goroutines
+type racer struct {
+	samplers.Samplers
+	detail *samplers.View
+	table  *samplers.Table[raceRow]
+}
+
+func raceData(n int) map[string]raceRow {
+	m := make(map[string]raceRow, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("row%d", i)
+		m[name] = raceRow{name, i, 2 * n, float64(i) / 3}
+	}
+	return m
+}
+
+func (r *racer) InitSampler() (err error) {
+	c, names, sortcol, err := r.ColumnInfo(raceRow{})
+	if err != nil {
+		return
+	}
+	r.SetColumns(c)
+	r.SetColumnNames(names)
+	r.SetSortColumn(sortcol)
+	if r.detail, err = r.AddView("detail", "SYSTEM"); err != nil {
+		return
+	}
+	r.table, err = samplers.NewTable[raceRow](r.detail)
+	return
+}
+
+func (r *racer) DoSample() error {
+	if err := r.UpdateTableFromMap(raceData(10)); err != nil {
+		return err
+	}
+	return r.HeadlinesFromStruct(raceHeadlines{10, "sample"})
+}
+
+// run with go test -race, which reports the problems rather than this
+func TestConcurrentUse(t *testing.T) {
+	n := samplertest.NewNetprobe()
+	conn, err := n.Connection(samplertest.Entity, samplertest.Sampler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &racer{}
+	r.Plugins = r
+	if err = r.New(conn, "test", "SYSTEM"); err != nil {
+		t.Fatal(err)
+	}
+	clock := n.Clock()
+	r.SetClock(clock)
+	r.SetInterval(time.Second)
+	var wg sync.WaitGroup
+	if err = r.Start(&wg); err != nil {
+		t.Fatal(err)
+	}
+
+	const loops = 50
+	users := []func(i int){
+		// the sampler goroutine
+		func(i int) {
+			if clock.Waiters() > 0 {
+				clock.Advance(2 * time.Second)
+			}
+			time.Sleep(time.Millisecond)
+		},
+		// settings changed while the sampler runs
+		func(i int) {
+			r.SetRowLimit(5+i%3, "")
+			r.SetSummaryRow("", samplers.SummaryLast)
+			if err := r.SetSortOrder([]string{"-used", "name:nat"}[i%2]); err != nil {
+				t.Error(err)
+			}
+			if err := r.SetRowFilter("", fmt.Sprintf("row%d", i%10)); err != nil {
+				t.Error(err)
+			}
+			r.SetRowPolicy(samplers.RowPolicy{Grace: time.Second, Incremental: i%2 == 0})
+			r.SetInterval(time.Duration(1+i%2) * time.Second)
+			r.SetParameterRefresh(time.Duration(i) * time.Second)
+		},
+		func(i int) {
+			if err := r.AddComputedColumn("pct", "used*100/total", "precision=1"); err == nil {
+				r.RemoveComputedColumn("pct")
+			}
+			r.SetSortColumn("name")
+			r.ColumnNames()
+			r.Columns()
+		},
+		// the default view from another goroutine
+		func(i int) {
+			r.UpdateTableFromMap(raceData(i%15 + 1))
+			r.RowsFromMap(raceData(3))
+			r.UpdateTableFromMapDelta(raceData(5), raceData(4), time.Second)
+			r.HeadlinesFromStruct(raceHeadlines{i, "user"})
+			r.Headline("extra", fmt.Sprint(i))
+		},
+		// a second view and a table on it
+		func(i int) {
+			r.detail.UpdateTableFromSlice([]raceRow{{"a", i, 2, 0}, {"b", 1, 2, 0}})
+			r.table.SetSortOrder("-load")
+			samplers.UpdateTableFromMap(r.table, raceData(i%5+1))
+			r.table.UpdateTableFromSlice([]raceRow{{"a", i, 2, 0}})
+			r.Views()
+			r.ViewByName("detail")
+		},
+	}
+	var g sync.WaitGroup
+	for _, f := range users {
+		g.Add(1)
+		go func(f func(int)) {
+			defer g.Done()
+			for i := 0; i < loops; i++ {
+				f(i)
+			}
+		}(f)
+	}
+	g.Wait()
+
+	// closing while updates are still being made
+	g.Add(2)
+	go func() {
+		defer g.Done()
+		for i := 0; i < loops; i++ {
+			r.UpdateTableFromMap(raceData(3))
+			r.HeadlinesFromStruct(raceHeadlines{i, "closing"})
+		}
+	}()
+	go func() {
+		defer g.Done()
+		r.Stop()
+		r.Close()
+		r.detail.Close()
+	}()
+	g.Wait()
+	wg.Wait()
+}
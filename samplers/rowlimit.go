@@ -0,0 +1,130 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"strconv"
+
+	"wonderland.org/geneos/xmlrpc"
+)
+
+// DefaultOtherName is the row name of the roll-up row for rows beyond
+// the row limit unless changed with SetRowLimit()
+const DefaultOtherName = "_Other"
+
+const (
+	// headlines published by the table update methods when there is a
+	// row limit
+	totalRowsHeadline     = "totalRows"
+	truncatedRowsHeadline = "truncatedRows"
+)
+
+// rowCounts records the number of rows before and after the row limit
+// was applied by the last update, and the values last published as
+// headlines
+type rowCounts struct {
+	total, truncated         int
+	senttotal, senttruncated string
+}
+
+/*
+SetRowLimit limits the number of rows published by the table update
+methods to the first limit rows, in sort order for maps and the order
+given for slices. The rows beyond the limit are collapsed into a single
+roll-up row, named othername or DefaultOtherName if empty, which shows
+the columns with summary= tags aggregated over those rows. The summary
+row, if any, is still over all the rows.
+
+With a limit the update methods also publish "totalRows" and
+"truncatedRows" headlines with the number of rows before the limit and
+the number collapsed. A limit of zero, the default, turns this off.
+*/
+func (l *layout) SetRowLimit(limit int, othername string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rowlimit = limit
+	l.othername = othername
+	if l.counts == nil {
+		l.counts = &rowCounts{}
+	}
+}
+
+// RowLimit returns the row limit and the name of the roll-up row
+func (l *layout) RowLimit() (int, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rowLimit()
+}
+
+func (l *layout) rowLimit() (int, string) {
+	if l.othername == "" {
+		return l.rowlimit, DefaultOtherName
+	}
+	return l.rowlimit, l.othername
+}
+
+// truncate applies the row limit to sorted rows, replacing the rows
+// beyond it with a roll-up row aggregating vals
+func (l *layout) truncate(enc *encoder, rows [][]string, vals [][]interface{}) ([][]string, error) {
+	total, truncated := len(rows), 0
+	if l.rowlimit > 0 && len(rows) > l.rowlimit {
+		truncated = len(rows) - l.rowlimit
+		var rest [][]interface{}
+		if vals != nil {
+			rest = vals[l.rowlimit:]
+		}
+		_, name := l.rowLimit()
+		other, err := newSummary(enc, rest).row(name)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows[:l.rowlimit:l.rowlimit], other)
+	}
+	if l.counts != nil {
+		l.counts.total, l.counts.truncated = total, truncated
+	}
+	return rows, nil
+}
+
+// publishRowCounts updates the row count headlines on d, if there is a
+// row limit, when they have changed
+func (l *layout) publishRowCounts(d *xmlrpc.Dataview) (err error) {
+	if l.rowlimit <= 0 || l.counts == nil {
+		return
+	}
+	c := l.counts
+	total, truncated := strconv.Itoa(c.total), strconv.Itoa(c.truncated)
+	if total != c.senttotal {
+		if err = publishHeadline(d, totalRowsHeadline, total, c.senttotal == ""); err != nil {
+			return
+		}
+		c.senttotal = total
+	}
+	if truncated != c.senttruncated {
+		if err = publishHeadline(d, truncatedRowsHeadline, truncated, c.senttruncated == ""); err != nil {
+			return
+		}
+		c.senttruncated = truncated
+	}
+	return
+}
+
+// publishHeadline sets a headline, creating it if this is the first time
+func publishHeadline(d *xmlrpc.Dataview, name string, value string, first bool) error {
+	if first {
+		return d.Headline(name, value)
+	}
+	return d.UpdateHeadline(name, value)
+}
+
+// publish replaces the contents of d with rows, or applies the row
+// policy if one is set, and then updates any row count headlines
+func (l *layout) publish(d *xmlrpc.Dataview, rows [][]string) (err error) {
+	if l.rowstate != nil {
+		err = l.rowstate.publish(d, l.columnnames, rows, l.timeSource().Now())
+	} else {
+		err = d.UpdateTable(l.columnnames, rows...)
+	}
+	if err != nil {
+		return
+	}
+	return l.publishRowCounts(d)
+}
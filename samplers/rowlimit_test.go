@@ -0,0 +1,122 @@
+package samplers
+
+import (
+	"reflect"
+	"testing"
+)
+
+type limitRow struct {
+	Name  string  `column:"name,sort=nat"`
+	Bytes uint64  `column:"bytes,summary=sum"`
+	Load  float64 `column:"load,summary=avg,precision=1"`
+	Peak  float64 `column:"peak,summary=max"`
+	State string  `column:"state,summary=count"`
+}
+
+func TestRowLimitAndSummary(t *testing.T) {
+	data := map[string]limitRow{
+		"p1": {"p1", 10, 1, 5, "R"},
+		"p2": {"p2", 20, 2, 7, "S"},
+		"p3": {"p3", 30, 3, 2, "S"},
+		"p4": {"p4", 40, 6, 1, "R"},
+	}
+	tests := []struct {
+		name      string
+		limit     int
+		other     string
+		summary   string
+		position  SummaryPosition
+		want      [][]string
+		wantCount [2]int
+	}{
+		{
+			name: "summary only",
+			want: [][]string{
+				{"p1", "10", "1.0", "5", "R"},
+				{"p2", "20", "2.0", "7", "S"},
+				{"p3", "30", "3.0", "2", "S"},
+				{"p4", "40", "6.0", "1", "R"},
+				{"_Total", "100", "3.0", "7", "4"},
+			},
+		},
+		{
+			name:      "limit with roll-up",
+			limit:     2,
+			summary:   "_All",
+			position:  SummaryFirst,
+			wantCount: [2]int{4, 2},
+			want: [][]string{
+				{"_All", "100", "3.0", "7", "4"},
+				{"p1", "10", "1.0", "5", "R"},
+				{"p2", "20", "2.0", "7", "S"},
+				{"_Other", "70", "4.5", "2", "2"},
+			},
+		},
+		{
+			name:      "limit not reached",
+			limit:     10,
+			other:     "rest",
+			position:  SummaryNone,
+			wantCount: [2]int{4, 0},
+			want: [][]string{
+				{"p1", "10", "1.0", "5", "R"},
+				{"p2", "20", "2.0", "7", "S"},
+				{"p3", "30", "3.0", "2", "S"},
+				{"p4", "40", "6.0", "1", "R"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		v := testView(t, limitRow{})
+		v.SetSummaryRow(tt.summary, tt.position)
+		if tt.limit > 0 {
+			v.SetRowLimit(tt.limit, tt.other)
+		}
+		rows, err := v.RowsFromMap(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, rows, tt.want)
+		}
+		if v.counts != nil {
+			if got := [2]int{v.counts.total, v.counts.truncated}; got != tt.wantCount {
+				t.Errorf("%s: row counts %v, want %v", tt.name, got, tt.wantCount)
+			}
+		}
+	}
+}
+
+func TestRowNameClash(t *testing.T) {
+	v := testView(t, limitRow{})
+	if _, err := v.RowsFromMap(map[string]limitRow{"a": {Name: "_Total"}}); err == nil {
+		t.Error("a row named like the summary row: no error")
+	}
+	if _, err := v.RowsFromSlice([]limitRow{{Name: "x"}, {Name: "x"}}); err == nil {
+		t.Error("duplicate row names: no error")
+	} else if d, ok := err.(*DuplicateRowsError); !ok || !reflect.DeepEqual(d.Names, []string{"x"}) {
+		t.Errorf("duplicate row names: got %v", err)
+	}
+}
+
+// summaries of integer columns suit integer formats
+func TestIntegerSummary(t *testing.T) {
+	type row struct {
+		Name  string `column:"name,sort="`
+		Sum   int    `column:"sum,format=%d,summary=sum"`
+		Avg   int    `column:"avg,format=%d,summary=avg"`
+		Whole int    `column:"whole,format=%d,summary=avg"`
+		Min   uint   `column:"min,format=%5d,summary=min"`
+		Max   int64  `column:"max,format=%.1f,summary=max"`
+		Count int    `column:"count,format=%d,summary=count"`
+	}
+	v := testView(t, row{})
+	v.SetSummaryRow("", SummaryLast)
+	rows, err := v.RowsFromSlice([]row{{"a", 1, 1, 2, 1, 1, 1}, {"b", 2, 2, 4, 2, 2, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"_Total", "3", "1.50", "3", "    1", "2.0", "2"}; !reflect.DeepEqual(rows[2], want) {
+		t.Errorf("got %q, want %q", rows[2], want)
+	}
+}
@@ -0,0 +1,175 @@
+package samplers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type connection struct {
+	_     struct{} `column:"connection,rowname=${Host}:${Port},sort="`
+	Host  string   `column:"host"`
+	Port  int      `column:"OMIT"`
+	Proto string   `column:"proto"`
+	Bytes uint64   `column:"bytes,delta=delta"`
+}
+
+func TestRowNames(t *testing.T) {
+	// each data is a slice of rows, which are sorted by row name
+	tests := []struct {
+		name string
+		data interface{}
+		want [][]string
+	}{
+		{"first field", []struct {
+			Name  string `column:"name,sort="`
+			Value int    `column:"value"`
+		}{{"b", 1}, {"a", 2}}, [][]string{{"a", "2"}, {"b", "1"}}},
+		{"later field", []struct {
+			Value int    `column:"value"`
+			Name  string `column:"name,rowname=,sort="`
+		}{{1, "b"}, {2, "a"}}, [][]string{{"a", "2"}, {"b", "1"}}},
+		{"template", []connection{{Host: "db", Port: 5432, Proto: "tcp"}, {Host: "db", Port: 80, Proto: "tcp"}},
+			[][]string{{"db:5432", "db", "tcp", "0"}, {"db:80", "db", "tcp", "0"}}},
+		{"literal text", []struct {
+			_    struct{} `column:"disk,rowname=/dev/${Dev}p${Part} (${Kind}),sort="`
+			Dev  string
+			Part uint8
+			Kind string  `column:"OMIT"`
+			Used float64 `column:"used,format=%.1f"`
+		}{{Dev: "sda", Part: 1, Kind: "ext4", Used: 12.5}}, [][]string{{"/dev/sdap1 (ext4)", "sda", "1", "12.5"}}},
+		{"literal only", []struct {
+			_    struct{} `column:"name,rowname=fixed"`
+			Used int      `column:"used"`
+		}{{Used: 1}}, [][]string{{"fixed", "1"}}},
+		{"plain values", []struct {
+			_     struct{}      `column:"name,rowname=${Ratio}/${Up}/${On},sort="`
+			Ratio float64       `column:"ratio,format=%.2f"`
+			Up    time.Duration `column:"OMIT"`
+			On    bool          `column:"OMIT"`
+		}{{Ratio: 0.5, Up: time.Minute, On: true}}, [][]string{{"0.5/1m0s/true", "0.50"}}},
+	}
+	for _, tt := range tests {
+		v := testView(t, reflect.ValueOf(tt.data).Index(0).Interface())
+		rows, err := v.RowsFromSlice(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		sortRowNames(rows)
+		if !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, rows, tt.want)
+		}
+	}
+}
+
+// sortRowNames sorts rows by row name, as RowsFromSlice() leaves them in
+// the order given
+func sortRowNames(rows [][]string) {
+	for i := 1; i < len(rows); i++ {
+		for j := i; j > 0 && rows[j][0] < rows[j-1][0]; j-- {
+			rows[j], rows[j-1] = rows[j-1], rows[j]
+		}
+	}
+}
+
+func TestRowNameTemplateDelta(t *testing.T) {
+	v := testView(t, connection{})
+	old := map[string]connection{"a": {Host: "db", Port: 5432, Bytes: 100}}
+	new := map[string]connection{"a": {Host: "db", Port: 5432, Bytes: 150}}
+	rows, err := v.RowsFromMapDelta(new, old, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"db:5432", "db", "", "50"}; !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("got %q, want %q", rows[0], want)
+	}
+}
+
+func TestRowNameErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    interface{}
+		wantErr string
+	}{
+		{"two row names", struct {
+			A string `column:"a,rowname="`
+			B string `column:"b,rowname="`
+		}{}, "both rowname columns"},
+		{"omitted", struct {
+			A string `column:"OMIT,rowname="`
+			B string
+		}{}, "cannot be OMIT"},
+		{"unknown field", struct {
+			_    struct{} `column:"name,rowname=${Host}:${Nope}"`
+			Host string
+		}{}, `unknown field "Nope"`},
+		{"unterminated", struct {
+			_    struct{} `column:"name,rowname=${Host"`
+			Host string
+		}{}, "missing '}'"},
+		{"comma", struct {
+			_    struct{} `column:"name,rowname=${Host},${Port}"`
+			Host string
+			Port int
+		}{}, "cannot contain a comma"},
+	}
+	for _, tt := range tests {
+		var v View
+		c, _, _, err := v.ColumnInfo(tt.data)
+		if err == nil {
+			v.SetColumns(c)
+			data := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(tt.data)), 1, 1)
+			_, err = v.RowsFromSlice(data.Interface())
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRowNamesFromKeys(t *testing.T) {
+	type row struct {
+		Name  string `column:"name,sort="`
+		Value int    `column:"value"`
+	}
+	data := map[string]row{"k1": {"x", 1}, "k2": {"x", 2}, "k3": {"y", 3}, "k4": {"y", 4}, "k5": {"z", 5}}
+	old := map[string]row{"k1": {"x", 0}}
+	v := testView(t, row{})
+
+	// the values of the row name field are duplicated
+	var dup *DuplicateRowsError
+	if _, err := v.RowsFromMap(data); !errors.As(err, &dup) || !reflect.DeepEqual(dup.Names, []string{"x", "y"}) {
+		t.Errorf("RowsFromMap(): error %v, want duplicates x and y", err)
+	}
+	if _, err := v.RowsFromMapDelta(data, old, time.Second); !errors.As(err, &dup) {
+		t.Errorf("RowsFromMapDelta(): error %v, want duplicates", err)
+	}
+
+	// the keys are not
+	v.SetRowNamesFromKeys(true)
+	if !v.RowNamesFromKeys() {
+		t.Error("RowNamesFromKeys() = false")
+	}
+	rows, err := v.RowsFromMap(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"k1", "1"}, {"k2", "2"}, {"k3", "3"}, {"k4", "4"}, {"k5", "5"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("RowsFromMap() = %q, want %q", rows, want)
+	}
+	if rows, err = v.RowsFromMapDelta(data, old, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows[0], []string{"k1", "1"}) || len(rows) != 5 {
+		t.Errorf("RowsFromMapDelta() = %q", rows)
+	}
+
+	// slices have no keys
+	if _, err = v.RowsFromSlice([]row{{"x", 1}, {"x", 2}}); !errors.As(err, &dup) {
+		t.Errorf("RowsFromSlice(): error %v, want duplicates", err)
+	}
+}
@@ -3,7 +3,6 @@ package samplers // import "wonderland.org/geneos/samplers"
 import (
 	"fmt"
 	"reflect"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -11,7 +10,8 @@ import (
 
 	"wonderland.org/geneos"
 	"wonderland.org/geneos/plugins"
-	"wonderland.org/geneos/xmlrpc"
+	"wonderland.org/geneos/shutdown"
+	"wonderland.org/geneos/streams"
 )
 
 func init() {
@@ -30,16 +30,29 @@ type SamplerInstance interface {
 	DoSample() (err error)
 }
 
-// All plugins share common settings
+// All plugins share common settings. The default View, created by
+// New(), is embedded so the helper methods below can be called directly
+// on the plugin. Further dataviews can be added with AddView()
 type Samplers struct {
 	plugins.Plugins
-	*xmlrpc.Dataview
-	name        string
-	group       string
-	interval    time.Duration
-	columns     Columns
-	columnnames []string
-	sortcolumn  string
+	*View
+	name       string
+	group      string
+	connection plugins.Connection
+
+	// mu guards the fields below, so that the settings can be changed
+	// while the sampler is running
+	mu       sync.Mutex
+	interval time.Duration
+	views    []*View
+
+	restartpolicy *RestartPolicy
+	stream        *streams.Stream
+	params        *boundParameters // set by BindParameters()
+	clock         Clock            // set by SetClock(), SystemClock if nil
+
+	stop    chan struct{} // closed by Stop()
+	stopped chan struct{} // closed when the sampler goroutine exits
 }
 
 // Columns is a common type for the map of rows for output.
@@ -51,25 +64,95 @@ type columndetails struct {
 	name     string                   // display name of column. name="OMIT" mean not rendered
 	number   int                      // column index - convenience for now
 	format   string                   // alterative Printf format, default is %v
-	convfunc func(interface{}) string // this may happen - not yet used
-	sort     sortType                 // if this is the sorting column then what type from above
+	convfunc func(interface{}) string // named custom converter from conv=, see RegisterConverter()
+	sort     sortType                 // how this column is compared if it is a sort key, sortNone if not
+	rowname  bool                     // this is the row name column
+	template string                   // optional rowname template of ${Field} references
+	delta    deltaMode                // how the column is rendered by the Delta helpers
+	counter  int                      // counter wraparound width in bits, 0 if not a counter
+
+	unit       string           // unit to scale numbers to, or auto to humanise bytes
+	precision  int              // decimal places, -1 if not set
+	timeformat string           // rfc3339, age or a time.Format layout for time.Time
+	location   *time.Location   // time zone for time.Time, nil to leave as-is
+	boollabels []string         // labels for true and false
+	enum       map[int64]string // labels for integer values
+
+	sortdesc     bool // sort key is descending
+	sortpriority int  // lower sorts first, ties in field order
+
+	expr    string    // expression for a computed column, which has no field
+	added   bool      // added by AddComputedColumn(), not declared by a tag
+	summary aggregate // how the column is shown in the summary row
+	window  *window   // rolling-window aggregation of the column, nil if none
 }
 
 const (
-	// sort=[+|-][num] = sort by this column optionally asc/desc and optionally numeric, one or the other
+	// columntag is the struct tag key for column options
+	columntag = "column"
+	// exprtag is the struct tag key for the expression of a computed
+	// column, declared on a blank field, e.g.
+	//   _ struct{} `column:"pctUsed,precision=1" expr:"Used/Total*100"`
+	exprtag = "expr"
+	// sort=[+|-][num|nat|lex][:N] = sort by this column optionally asc/desc,
+	// numeric, natural or lexical (the default). Several columns can be
+	// sort keys, in order of N and then field order
 	sorting = "sort"
 	// format is a fmt.Printf format string for the data and defaults to %v
 	format = "format"
+	// prefix=STRING on a nested struct field flattens the struct into
+	// columns named with the prefix. Embedded structs are always flattened
+	prefix = "prefix"
+	// rowname=[TEMPLATE] makes this the row name column, always the first
+	// column, optionally built from other fields, e.g. rowname=${Host}:${Port}.
+	// Tags are split on commas, so a template cannot contain one
+	rowname = "rowname"
+	// delta=rate|delta|absolute selects how a numeric column is rendered by
+	// the Delta helpers. The default is rate, the difference per second
+	deltatag = "delta"
+	// counter=32|64 makes the field a counter that wraps at that width,
+	// counter=no, the default, renders decreases as-is
+	countertag = "counter"
+	// unit=B|KiB|MiB|GiB|TiB|KB|MB|GB|TB scales a count of bytes and
+	// unit=ns|us|ms|s|min|h scales nanoseconds or a time.Duration.
+	// unit=auto humanises bytes, e.g. "1.5 GiB", or formats a Duration
+	unittag = "unit"
+	// precision=N is the number of decimal places, the same as format=%.Nf
+	precisiontag = "precision"
+	// time=rfc3339|age|LAYOUT formats a time.Time, age being the time
+	// since then. tz=ZONE converts it to a time zone, e.g. tz=UTC
+	timetag = "time"
+	tztag   = "tz"
+	// bool=TRUE|FALSE sets the labels for a bool field
+	booltag = "bool"
+	// enum=0:OK|1:WARNING|2:CRITICAL maps integer values to labels
+	enumtag = "enum"
+	// conv=NAME uses a converter added with RegisterConverter()
+	convtag = "conv"
+	// summary=sum|avg|min|max|count adds the column to the summary row
+	summarytag = "summary"
+	// window=sum|avg|min|max|count:N|DURATION shows the column aggregated
+	// over the last N samples or DURATION, e.g. window=avg:5 or window=max:1m.
+	// Put it on a computed column that names a field, expr:"Busy", to show
+	// the average next to the instant value
+	windowtag = "window"
+)
+
+type deltaMode int
+
+const (
+	deltaRate deltaMode = iota
+	deltaDiff
+	deltaAbsolute
 )
 
 type sortType int
 
 const (
 	sortNone sortType = iota
-	sortAsc
-	sortDesc
-	sortAscNum
-	sortDescNum
+	sortLex           // plain string comparison
+	sortNum           // numeric, cells that are not numbers are zero
+	sortNat           // natural, runs of digits compare as numbers
 )
 
 // these two internal functions implement the redirection required to
@@ -77,6 +160,9 @@ const (
 // there, using direct calls, the process will crash if one of the functions
 // isn't defined and there is no way to check before calling. this also
 // allows for future shared initialisation code
+//
+// both are called through protect() by the supervisor so that a panic
+// in a plugin doesn't take down every other sampler in the process
 
 func (p *Samplers) initSamplerInternal() error {
 	if v, ok := interface{}(p.Plugins).(interface{ InitSampler() error }); ok {
@@ -87,6 +173,7 @@ func (p *Samplers) initSamplerInternal() error {
 }
 
 func (p *Samplers) doSampleInterval() error {
+	p.refreshParametersDue()
 	if v, ok := interface{}(p.Plugins).(interface{ DoSample() error }); ok {
 		return v.DoSample()
 	}
@@ -94,96 +181,139 @@ func (p *Samplers) doSampleInterval() error {
 	return nil
 }
 
+// Sample calls DoSample() once, now, as the sampler goroutine does each
+// interval, including the refresh of bound parameters. A panic is
+// returned as a *PanicError. It is mostly for tests, see the samplertest
+// package, where the sampler is not started.
+func (p *Samplers) Sample() error {
+	return protect(p.doSampleInterval)
+}
+
 func (s *Samplers) New(p plugins.Connection, name string, group string) error {
 	DebugLogger.Print("called")
 	s.name, s.group = name, group
 	return s.initDataviews(p)
 }
 
+// SetInterval sets the sample interval. If the sampler is running the
+// new interval takes effect after the next sample.
 func (p *Samplers) SetInterval(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.interval = interval
 	return
 }
 
-func (p Samplers) Interval() time.Duration {
+func (p *Samplers) Interval() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	return p.interval
 }
 
-func (p *Samplers) SetColumnNames(columnnames []string) {
-	p.columnnames = columnnames
-	return
-}
-
-func (p Samplers) ColumnNames() []string {
-	return p.columnnames
-}
-
-func (p *Samplers) SetColumns(columns Columns) {
-	p.columns = columns
-	return
-}
-
-func (p Samplers) Columns() Columns {
-	return p.columns
+// SetClock sets the Clock used by the sampler and all its views, for
+// tests. Call it before Start(), the default is SystemClock.
+func (p *Samplers) SetClock(clock Clock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clock = clock
+	for _, v := range p.views {
+		v.SetClock(clock)
+	}
 }
 
-func (p *Samplers) SetSortColumn(column string) {
-	p.sortcolumn = column
-	return
+func (p *Samplers) Clock() Clock {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.timeSource()
 }
 
-func (p Samplers) SortColumn() string {
-	return p.sortcolumn
+// timeSource returns the Clock to use. The caller holds p.mu
+func (p *Samplers) timeSource() Clock {
+	if p.clock == nil {
+		return SystemClock
+	}
+	return p.clock
 }
 
 func (s *Samplers) initDataviews(p plugins.Connection) (err error) {
-	d, err := p.NewDataview(s.name, s.group)
+	s.connection = p
+	s.mu.Lock()
+	s.views = nil
+	s.mu.Unlock()
+	v, err := s.AddView(s.name, s.group)
 	if err != nil {
 		return
 	}
-	s.Dataview = d
+	s.View = v
 	return
 }
 
+// Start calls InitSampler() and then DoSample() every interval in a new
+// goroutine, added to wg. An error from InitSampler() is returned but a
+// panic is restarted under the RestartPolicy, like one in DoSample().
 func (p *Samplers) Start(wg *sync.WaitGroup) (err error) {
 	if !p.IsValid() {
 		err = fmt.Errorf("Start(): Dataview not defined")
 		return
 	}
-	err = p.initSamplerInternal()
-	if err != nil {
-		return
+	initerr := protect(p.initSamplerInternal)
+	if _, ok := initerr.(*PanicError); initerr != nil && !ok {
+		return initerr
 	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	p.mu.Lock()
+	p.stop, p.stopped = stop, stopped
+	p.mu.Unlock()
 	wg.Add(1)
 	go func() {
-		tick := time.NewTicker(p.Interval())
-		defer tick.Stop()
-		for {
-			<-tick.C
-			err := p.doSampleInterval()
-			if err != nil {
-				break
-			}
-		}
-		wg.Done()
+		defer wg.Done()
+		defer close(stopped)
+		p.supervise(stop, initerr)
 		Logger.Printf("sampler %q exiting\n", p.ToString())
-
 	}()
+	shutdown.Register(p, shutdown.Hook{Name: p.ToString(), Stop: p.Stop, Teardown: p.Close})
 	return
 }
 
-func (s *Samplers) Close() error {
-	if !s.IsValid() {
-		return nil
+// Stop stops calling DoSample() and waits for any call in progress to
+// return. The dataviews are left in place, use Close() to remove them.
+// It does nothing if the sampler is not running.
+func (p *Samplers) Stop() {
+	p.mu.Lock()
+	stop, stopped := p.stop, p.stopped
+	if stop == nil {
+		p.mu.Unlock()
+		return
+	}
+	select {
+	case <-stop:
+	default:
+		close(stop)
 	}
-	return s.Dataview.Close()
+	p.mu.Unlock()
+	<-stopped
+}
+
+// Close removes all the dataviews of the sampler and returns the first
+// error, if any. It does not stop the sampler, see Stop()
+func (s *Samplers) Close() (err error) {
+	shutdown.Unregister(s)
+	for _, v := range s.Views() {
+		if !v.IsValid() {
+			continue
+		}
+		if e := v.Dataview.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
 }
 
 // the methods below are helpers for common cases of needing to render a struct of data as
 // a row etc.
 
 /*
-ColumnInfo is a helper function that takes a (flat) struct as input
+ColumnInfo is a helper function that takes a struct as input
 and returns an ordered slice of column names ready to update a dataview.
 Normally called once per sampler during initialisation.
 
@@ -191,11 +321,16 @@ The column names are the display names in the struct tags or the field name
 otherwise. The internal method parsetags() is where the valid options are
 defined in detail. More docs to follow.
 
+Embedded structs, and nested struct fields with a "prefix=" tag, are
+flattened into one column per field. The columns of nested fields are
+keyed by their dotted path, e.g. "Rx.Bytes", while those of embedded
+structs use the promoted field name, just like Go. Pointers to structs
+are followed in the same way and a nil pointer renders as empty cells.
+
 The input is a type or an zero-ed struct as this method only checks the struct
 tags and doesn't care about the data
-
 */
-func (s Samplers) ColumnInfo(rowdata interface{}) (cols Columns,
+func (s *View) ColumnInfo(rowdata interface{}) (cols Columns,
 	columnnames []string, sorting string, err error) {
 	rv := reflect.Indirect(reflect.ValueOf(rowdata))
 	if rv.Kind() != reflect.Struct {
@@ -203,50 +338,259 @@ func (s Samplers) ColumnInfo(rowdata interface{}) (cols Columns,
 		return
 	}
 
-	rt := rv.Type()
-	cols = make(Columns, rt.NumField())
-	sorting = rt.Field(0).Name
+	fields, err := flattenFields(rv.Type(), columntag)
+	if err != nil {
+		return
+	}
+	if len(fields) == 0 {
+		err = fmt.Errorf("rowdata has no fields")
+		return
+	}
+
+	cols = make(Columns, len(fields))
+	sorting = fields[0].key
+	rownamekey, rownamecol := "", 0
+	var sortpriority *int
 
-	for i := 0; i < rt.NumField(); i++ {
+	for i, f := range fields {
 		column := columndetails{}
-		fieldname := rt.Field(i).Name
-		if tags, ok := rt.Field(i).Tag.Lookup("column"); ok {
-			column, err = parseTags(fieldname, tags)
+		if f.hastag {
+			column, err = parseTags(f.name, f.tag)
 			if err != nil {
 				return
 			}
-			// check for already set values and error
-			if column.sort != sortNone {
-				sorting = fieldname
+			// the sort column is the highest priority sort key
+			if column.sort != sortNone && (sortpriority == nil || column.sortpriority < *sortpriority) {
+				sorting = f.key
+				sortpriority = &column.sortpriority
+			}
+			if column.rowname {
+				if rownamekey != "" {
+					err = fmt.Errorf("fields %q and %q are both rowname columns", rownamekey, f.key)
+					return
+				}
+				if column.name == "OMIT" || f.omit {
+					err = fmt.Errorf("rowname field %q cannot be OMIT", f.key)
+					return
+				}
+				rownamekey, rownamecol = f.key, len(columnnames)
 			}
-			column.number = i
 		} else {
-			column.name = fieldname
-			column.number = i
+			column.name = f.name
 			column.format = "%v"
+			column.precision = -1
+		}
+		column.number = i
+		if f.expr != "" {
+			if column.rowname {
+				err = fmt.Errorf("computed column %q cannot be the rowname", f.key)
+				return
+			}
+			if _, err = parseExpr(f.expr); err != nil {
+				return
+			}
+			column.expr = f.expr
+		}
+		if f.omit {
+			column.name = "OMIT"
 		}
 		// A column marked "OMIT" is still useable but is not included
 		// in the column names
 		if column.name != "OMIT" {
+			column.name = f.prefix + column.name
 			columnnames = append(columnnames, column.name)
 		}
-		cols[fieldname] = column
+		cols[f.key] = column
 	}
 
+	// the row name column is always first, so move it and renumber the
+	// columns before it. it is also the default sort column.
+	if rownamekey != "" {
+		rn := cols[rownamekey]
+		for k, c := range cols {
+			if c.number < rn.number {
+				c.number++
+				cols[k] = c
+			}
+		}
+		columnnames = append(append([]string{rn.name}, columnnames[:rownamecol]...), columnnames[rownamecol+1:]...)
+		rn.number = 0
+		cols[rownamekey] = rn
+		if cols[sorting].sort == sortNone {
+			sorting = rownamekey
+		}
+	}
+
+	return
+}
+
+// field is a struct field after flattening embedded and nested structs
+type field struct {
+	key    string       // the key in Columns
+	name   string       // the field name
+	index  []int        // index path from the top level struct
+	typ    reflect.Type // the field type
+	tag    string       // the "column" (or "headline") tag, if any
+	hastag bool
+	prefix string // the display name prefix from enclosing structs
+	omit   bool   // an enclosing struct is OMIT
+	expr   string // the expression of a computed column, from an expr tag
+}
+
+// flattenFields returns the fields of struct type rt with embedded
+// structs and nested structs with a prefix tag replaced by their own
+// fields, recursively. tagkey is the struct tag key holding the options
+func flattenFields(rt reflect.Type, tagkey string) (fields []field, err error) {
+	err = flatten(rt, tagkey, nil, "", "", false, []reflect.Type{rt}, &fields)
+	if err != nil {
+		return
+	}
+	keys := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if keys[f.key] {
+			return nil, fmt.Errorf("duplicate field %q after flattening %v", f.key, rt)
+		}
+		keys[f.key] = true
+	}
 	return
 }
 
+func flatten(rt reflect.Type, tagkey string, index []int, key string, nameprefix string, omit bool,
+	parents []reflect.Type, fields *[]field) error {
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag, hastag := sf.Tag.Lookup(tagkey)
+		expression, computed := sf.Tag.Lookup(exprtag)
+		fieldindex := append(append([]int{}, index...), i)
+		if computed {
+			// computed columns are declared on blank fields and are
+			// keyed by their column name as they have no field name
+			name := tagName(tag)
+			if sf.Name != "_" || name == "" || name == "OMIT" {
+				return fmt.Errorf("field %q: expr tags must be on a blank field with a column name", sf.Name)
+			}
+			*fields = append(*fields, field{
+				key:    key + name,
+				name:   name,
+				index:  fieldindex,
+				typ:    sf.Type,
+				tag:    tag,
+				hastag: hastag,
+				prefix: nameprefix,
+				omit:   omit,
+				expr:   expression,
+			})
+			continue
+		}
+		if sf.Name == "_" {
+			// blank fields are only used to carry rowname templates
+			// and computed columns
+			if _, ok := tagValue(tag, rowname); ok {
+				*fields = append(*fields, field{
+					key:    key + sf.Name,
+					name:   sf.Name,
+					index:  fieldindex,
+					typ:    sf.Type,
+					tag:    tag,
+					hastag: hastag,
+					prefix: nameprefix,
+					omit:   omit,
+				})
+			}
+			continue
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// unexported fields can't be rendered, but the exported fields
+		// of an unexported embedded struct are promoted as in Go
+		if !sf.IsExported() && !(sf.Anonymous && ft.Kind() == reflect.Struct) {
+			continue
+		}
+		if ft.Kind() == reflect.Struct && !isLeafStruct(ft) {
+			p, prefixed := tagValue(tag, prefix)
+			if sf.Anonymous || prefixed {
+				for _, t := range parents {
+					if t == ft {
+						return fmt.Errorf("field %q: recursive struct %v", sf.Name, ft)
+					}
+				}
+				childkey := key
+				if !sf.Anonymous {
+					childkey = key + sf.Name + "."
+				}
+				err := flatten(ft, tagkey, fieldindex, childkey, nameprefix+p, omit || tagName(tag) == "OMIT",
+					append(parents, ft), fields)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if !sf.IsExported() {
+			// an unexported embedded struct that renders itself
+			continue
+		}
+		*fields = append(*fields, field{
+			key:    key + sf.Name,
+			name:   sf.Name,
+			index:  fieldindex,
+			typ:    sf.Type,
+			tag:    tag,
+			hastag: hastag,
+			prefix: nameprefix,
+			omit:   omit,
+		})
+	}
+	return nil
+}
+
+// isLeafStruct returns true if a struct type renders itself, e.g.
+// time.Time, and so is a single column rather than being flattened
+func isLeafStruct(t reflect.Type) bool {
+	return hasFormatMethods(t) || implements(t, textMarshalerType)
+}
+
+// tagValue returns the value of the option name in a column tag and
+// true if it is present
+func tagValue(tag string, name string) (string, bool) {
+	for _, t := range strings.Split(tag, ",") {
+		if strings.HasPrefix(t, name+"=") {
+			return t[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
+// tagName returns the display name in a column tag, if any
+func tagName(tag string) string {
+	for _, t := range strings.Split(tag, ",") {
+		if t != "" && strings.IndexByte(t, '=') == -1 {
+			return t
+		}
+	}
+	return ""
+}
+
 /*
 UpdateTableFromMap - Given a map of structs representing rows of data,
 render a simple table update by converting all data and sorting the rows
-by the sort column in the initialised ColumnNames member of the Sampler
+by the sort column in the initialised ColumnNames member of the View
 
 Sorting the data is only to define the "natural sort order" of the data
 as it appears in a Geneos Dataview without further client-side sorting.
 */
-func (s *Samplers) UpdateTableFromMap(data interface{}) error {
-	table, _ := s.RowsFromMap(data)
-	return s.UpdateTable(s.ColumnNames(), table...)
+func (s *View) UpdateTableFromMap(data interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table, err := s.rowsFromMap(reflect.ValueOf(data), true)
+	if err != nil {
+		return err
+	}
+	return s.publish(s.Dataview, table)
 }
 
 /*
@@ -257,84 +601,47 @@ MB etc.)
 
 The data passed should NOT include column heading slice as it will be
 regenerated from the Columns data
-
 */
-func (s Samplers) RowsFromMap(rowdata interface{}) (rows [][]string, err error) {
-	c := s.Columns()
-	r := reflect.Indirect(reflect.ValueOf(rowdata))
-	if r.Kind() != reflect.Map {
-		err = fmt.Errorf("non Map passed")
-		return
-	}
-
-	for _, k := range r.MapKeys() {
-		var cells []string
-		rawcells, _ := rowFromStruct(c, r.MapIndex(k))
-		t := reflect.Indirect(r.MapIndex(k)).Type()
-		for i := range rawcells {
-			fieldname := t.Field(i).Name
-			format := c[fieldname].format
-			if c[fieldname].name == "OMIT" {
-				continue
-			}
-			cells = append(cells, fmt.Sprintf(format, rawcells[i]))
-		}
-		rows = append(rows, cells)
-	}
-
-	rows = c.sortRows(rows, s.SortColumn())
-
-	return
+func (s *View) RowsFromMap(rowdata interface{}) (rows [][]string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rowsFromMap(reflect.ValueOf(rowdata), false)
 }
 
 /*
 UpdateTableFromSlice - Given an ordered slice of structs of data the
 method renders a simple table of data as defined in the Columns
-part of Samplers
-
+part of the View
 */
-func (s Samplers) UpdateTableFromSlice(rowdata interface{}) error {
-	table, _ := s.RowsFromSlice(rowdata)
-	return s.UpdateTable(s.ColumnNames(), table...)
+func (s *View) UpdateTableFromSlice(rowdata interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table, err := s.rowsFromSlice(reflect.ValueOf(rowdata), true)
+	if err != nil {
+		return err
+	}
+	return s.publish(s.Dataview, table)
 }
 
 // RowsFromSlice - results are not resorted, they are assumed to be in the order
 // required
-func (s Samplers) RowsFromSlice(rowdata interface{}) (rows [][]string, err error) {
-	c := s.Columns()
-
-	rd := reflect.Indirect(reflect.ValueOf(rowdata))
-	if rd.Kind() != reflect.Slice {
-		err = fmt.Errorf("non Slice passed")
-		return
-	}
-
-	for i := 0; i < rd.Len(); i++ {
-		v := rd.Index(i)
-		t := v.Type()
-
-		rawcells, _ := rowFromStruct(c, v)
-		var cells []string
-		for i := range rawcells {
-			fieldname := t.Field(i).Name
-			format := c[fieldname].format
-			if c[fieldname].name == "OMIT" {
-				continue
-			}
-			cells = append(cells, fmt.Sprintf(format, rawcells[i]))
-		}
-		rows = append(rows, cells)
-	}
-
-	return
+func (s *View) RowsFromSlice(rowdata interface{}) (rows [][]string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rowsFromSlice(reflect.ValueOf(rowdata), false)
 }
 
 /*
 UpdateTableFromMapDelta
 */
-func (s *Samplers) UpdateTableFromMapDelta(newdata, olddata interface{}, interval time.Duration) error {
-	table, _ := s.RowsFromMapDelta(newdata, olddata, interval)
-	return s.UpdateTable(s.ColumnNames(), table...)
+func (s *View) UpdateTableFromMapDelta(newdata, olddata interface{}, interval time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table, err := s.rowsFromMapDelta(reflect.ValueOf(newdata), reflect.ValueOf(olddata), interval, true)
+	if err != nil {
+		return err
+	}
+	return s.publish(s.Dataview, table)
 }
 
 // RowsFromMapDelta takes two sets of data and calculates the difference between them.
@@ -342,131 +649,20 @@ func (s *Samplers) UpdateTableFromMapDelta(newdata, olddata interface{}, interva
 // unchanges and taken from newrowdata only. If an interval is supplied (non-zero) then that is used as
 // a scaling value otherwise the straight numeric difference is calculated
 //
-// This is for data like sets of counters that are absolute values over time
-func (s Samplers) RowsFromMapDelta(newrowdata, oldrowdata interface{},
+// This is for data like sets of counters that are absolute values over time.
+// The "delta" tag selects, per column, between the default per second
+// rate, the plain difference and the absolute new value, for gauges. A
+// field tagged as a counter that goes backwards is treated as a
+// wraparound if it was in the top half of its range and otherwise as a
+// reset, and the cell is left empty until the next sample. Rows that
+// are new since oldrowdata also have empty delta cells, while rows that
+// have gone are dropped. Whole differences of integer fields are
+// rendered as integers, so they suit formats such as %d.
+func (s *View) RowsFromMapDelta(newrowdata, oldrowdata interface{},
 	interval time.Duration) (rows [][]string, err error) {
-
-	c := s.Columns()
-
-	// if no interval is supplied - the same as an interval of zero
-	// then set 1 second as the interval as the divisor below takes
-	// the number of seconds as the value, hence cancelling itself out
-	if interval == 0 {
-		interval = 1 * time.Second
-	}
-
-	rnew := reflect.Indirect(reflect.ValueOf(newrowdata))
-	if rnew.Kind() != reflect.Map {
-		err = fmt.Errorf("non map passed")
-		return
-	}
-
-	rold := reflect.Indirect(reflect.ValueOf(oldrowdata))
-	if rold.Kind() != reflect.Map {
-		err = fmt.Errorf("non map passed")
-		return
-	}
-
-	for _, k := range rnew.MapKeys() {
-		rawold, _ := rowFromStruct(c, rold.MapIndex(k))
-		rawcells, _ := rowFromStruct(c, rnew.MapIndex(k))
-		var cells []string
-		t := reflect.Indirect(rnew.MapIndex(k)).Type()
-		for i := range rawcells {
-			fieldname := t.Field(i).Name
-			format := c[fieldname].format
-			if c[fieldname].name == "OMIT" {
-				continue
-			}
-
-			// calc diff here
-			oldcell, newcell := rawold[i], rawcells[i]
-			if reflect.TypeOf(oldcell) != reflect.TypeOf(newcell) {
-				err = fmt.Errorf("non-matching types in data")
-				return
-			}
-			// can these fields be converted to float (the concrete value)
-			// this is not the same as parsing a string as float, but the
-			// actual struct field being numeric
-			newfloat, nerr := toFloat(newcell)
-			oldfloat, oerr := toFloat(oldcell)
-			if nerr == nil && oerr == nil {
-				cells = append(cells, fmt.Sprintf(format, (newfloat-oldfloat)/interval.Seconds()))
-			} else {
-				// if we fail to convert then just render the new values directly
-				cells = append(cells, fmt.Sprintf(format, newcell))
-			}
-		}
-		rows = append(rows, cells)
-	}
-
-	rows = c.sortRows(rows, s.SortColumn())
-
-	return
-}
-
-func toFloat(f interface{}) (float64, error) {
-	var ft = reflect.TypeOf(float64(0))
-	v := reflect.ValueOf(f)
-	v = reflect.Indirect(v)
-	if !v.Type().ConvertibleTo(ft) {
-		return 0, fmt.Errorf("cannot convert %v to float", v.Type())
-	}
-	fv := v.Convert(ft)
-	return fv.Float(), nil
-}
-
-func (c Columns) sortRows(rows [][]string, sortcol string) [][]string {
-	sorttype, sortby := c[sortcol].sort, c[sortcol].number
-
-	sort.Slice(rows, func(a, b int) bool {
-		switch sorttype {
-		case sortDesc:
-			return rows[a][sortby] >= rows[b][sortby]
-		case sortAscNum:
-			// err is ignored, zero is a valid answer if the
-			// contents are not a float
-			an, _ := strconv.ParseFloat(rows[a][sortby], 64)
-			bn, _ := strconv.ParseFloat(rows[b][sortby], 64)
-			if an == bn {
-				return rows[a][sortby] < rows[b][sortby]
-			} else {
-				return an < bn
-			}
-		case sortDescNum:
-			// err is ignored, zero is a valid answer if the
-			// contents are not a float
-			an, _ := strconv.ParseFloat(rows[a][sortby], 64)
-			bn, _ := strconv.ParseFloat(rows[b][sortby], 64)
-			if an == bn {
-				return rows[a][sortby] >= rows[b][sortby]
-			} else {
-				return an >= bn
-			}
-		// case sortNone, sortAsc: - the default
-		default:
-			return rows[a][sortby] < rows[b][sortby]
-		}
-	})
-	return rows
-}
-
-// pivot the struct members to a slice of their values ready to be
-// processed to a slice of strings
-func rowFromStruct(c Columns, rv reflect.Value) (row []interface{}, err error) {
-	rv = reflect.Indirect(rv)
-	if rv.Kind() != reflect.Struct {
-		err = fmt.Errorf("row data not a struct")
-		return
-	}
-
-	rt := rv.Type()
-
-	for i := 0; i < rt.NumField(); i++ {
-		row = append(row, rv.Field(i).Interface())
-	}
-
-	return
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rowsFromMapDelta(reflect.ValueOf(newrowdata), reflect.ValueOf(oldrowdata), interval, false)
 }
 
 func parseTags(fieldname string, tag string) (cols columndetails, err error) {
@@ -474,11 +670,21 @@ func parseTags(fieldname string, tag string) (cols columndetails, err error) {
 	cols.tags = tag
 	cols.name = fieldname
 	cols.format = "%v"
+	cols.precision = -1
+	formatset := false
 
 	tags := strings.Split(tag, ",")
 	for _, t := range tags {
+		if t == "" {
+			continue
+		}
 		i := strings.IndexByte(t, '=')
 		if i == -1 {
+			if strings.Contains(t, "${") {
+				// the rest of a rowname template split at a comma
+				err = fmt.Errorf("field %q: rowname template cannot contain a comma", fieldname)
+				return
+			}
 			if cols.name != fieldname {
 				// err, already defined
 				err = fmt.Errorf("column name %q redefined more than once", cols.name)
@@ -487,25 +693,116 @@ func parseTags(fieldname string, tag string) (cols columndetails, err error) {
 			cols.name = t
 			continue
 		}
-		prefix := t[:i]
+		key := t[:i]
 
-		switch prefix {
+		switch key {
 		case sorting:
-			cols.sort = sortAsc
-			if t[i+1] == '-' {
-				cols.sort = sortDesc
-			}
-			if strings.HasSuffix(t[i+1:], "num") {
-				if cols.sort == sortAsc {
-					cols.sort = sortAscNum
-				} else {
-					cols.sort = sortDescNum
-				}
+			cols.sort, cols.sortdesc, cols.sortpriority, err = parseSortTag(t[i+1:])
+			if err != nil {
+				err = fmt.Errorf("field %q: %w", fieldname, err)
+				return
 			}
 
 		case format:
 			// no validation
 			cols.format = t[i+1:]
+			formatset = true
+
+		case rowname:
+			cols.rowname = true
+			cols.template = t[i+1:]
+
+		case deltatag:
+			switch t[i+1:] {
+			case "rate":
+				cols.delta = deltaRate
+			case "delta":
+				cols.delta = deltaDiff
+			case "absolute":
+				cols.delta = deltaAbsolute
+			default:
+				err = fmt.Errorf("field %q: unknown delta mode %q", fieldname, t[i+1:])
+				return
+			}
+
+		case countertag:
+			switch t[i+1:] {
+			case "32":
+				cols.counter = 32
+			case "64":
+				cols.counter = 64
+			case "no":
+				cols.counter = 0
+			default:
+				err = fmt.Errorf("field %q: unknown counter width %q", fieldname, t[i+1:])
+				return
+			}
+
+		case unittag:
+			if _, ok := units[t[i+1:]]; !ok && t[i+1:] != "auto" {
+				err = fmt.Errorf("field %q: unknown unit %q", fieldname, t[i+1:])
+				return
+			}
+			cols.unit = t[i+1:]
+
+		case precisiontag:
+			cols.precision, err = strconv.Atoi(t[i+1:])
+			if err != nil || cols.precision < 0 {
+				err = fmt.Errorf("field %q: invalid precision %q", fieldname, t[i+1:])
+				return
+			}
+
+		case timetag:
+			cols.timeformat = t[i+1:]
+
+		case tztag:
+			if cols.location, err = time.LoadLocation(t[i+1:]); err != nil {
+				err = fmt.Errorf("field %q: %w", fieldname, err)
+				return
+			}
+
+		case booltag:
+			cols.boollabels = parseLabels(t[i+1:])
+			if len(cols.boollabels) != 2 {
+				err = fmt.Errorf("field %q: bool labels must be TRUE|FALSE, not %q", fieldname, t[i+1:])
+				return
+			}
+
+		case enumtag:
+			if cols.enum, err = parseEnum(t[i+1:]); err != nil {
+				err = fmt.Errorf("field %q: %w", fieldname, err)
+				return
+			}
+
+		case summarytag:
+			if cols.summary, err = parseAggregate(t[i+1:]); err != nil {
+				err = fmt.Errorf("field %q: %w", fieldname, err)
+				return
+			}
+
+		case windowtag:
+			if cols.window, err = parseWindow(t[i+1:]); err != nil {
+				err = fmt.Errorf("field %q: %w", fieldname, err)
+				return
+			}
+
+		case convtag:
+			var ok bool
+			if cols.convfunc, ok = lookupConverter(t[i+1:]); !ok {
+				err = fmt.Errorf("field %q: no converter registered as %q", fieldname, t[i+1:])
+				return
+			}
+		}
+	}
+
+	// precision is shorthand for a format and scaled units default to
+	// two decimal places
+	if !formatset {
+		switch {
+		case cols.precision != -1:
+			cols.format = fmt.Sprintf("%%.%df", cols.precision)
+		case cols.unit != "" && cols.unit != "auto" && units[cols.unit] != 1:
+			cols.format = "%.2f"
 		}
 	}
 	return
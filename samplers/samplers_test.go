@@ -0,0 +1,81 @@
+package samplers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testView returns a View with the columns of rowdata
+func testView(t testing.TB, rowdata interface{}) *View {
+	t.Helper()
+	v := &View{}
+	c, n, s, err := v.ColumnInfo(rowdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetColumns(c)
+	v.SetColumnNames(n)
+	v.SetSortColumn(s)
+	return v
+}
+
+// version has only a MarshalText method
+type version struct{ major, minor int }
+
+func (v version) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("v%d.%d", v.major, v.minor)), nil
+}
+
+type counters struct {
+	Bytes   uint64
+	Packets uint64
+	dropped uint64
+}
+
+type hidden struct {
+	Zone string
+}
+
+type flatRow struct {
+	Name string `column:"name"`
+	time.Time
+	hidden
+	Version version
+	Rx      counters  `column:",prefix=rx"`
+	Tx      *counters `column:",prefix=tx"`
+	secret  string
+}
+
+func TestFlatten(t *testing.T) {
+	when := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := testView(t, flatRow{})
+	wantNames := []string{"name", "Time", "Zone", "Version", "rxBytes", "rxPackets", "txBytes", "txPackets"}
+	if got := v.ColumnNames(); !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("ColumnNames() = %q, want %q", got, wantNames)
+	}
+
+	tests := []struct {
+		row  flatRow
+		want []string
+	}{
+		{
+			flatRow{"a", when, hidden{"eu"}, version{1, 2}, counters{10, 1, 3}, &counters{20, 2, 4}, "x"},
+			[]string{"a", when.String(), "eu", "v1.2", "10", "1", "20", "2"},
+		},
+		{
+			flatRow{Name: "b"},
+			[]string{"b", time.Time{}.String(), "", "v0.0", "0", "0", "", ""},
+		},
+	}
+	for _, tt := range tests {
+		rows, err := v.RowsFromSlice([]flatRow{tt.row})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.row.Name, err)
+		}
+		if !reflect.DeepEqual(rows[0], tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.row.Name, rows[0], tt.want)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortKey is one key of a sort order, a column and how to compare it
+type sortKey struct {
+	column string // the key in Columns
+	desc   bool
+	mode   sortType
+}
+
+// parseSortTag parses the value of a sort= tag, [+|-][num|nat|lex][:N]
+func parseSortTag(value string) (mode sortType, desc bool, priority int, err error) {
+	if i := strings.LastIndexByte(value, ':'); i != -1 {
+		if priority, err = strconv.Atoi(value[i+1:]); err != nil {
+			err = fmt.Errorf("invalid sort priority %q", value[i+1:])
+			return
+		}
+		value = value[:i]
+	}
+	switch {
+	case strings.HasPrefix(value, "-"):
+		desc = true
+		value = value[1:]
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	}
+	if mode, err = parseSortMode(value); err != nil {
+		return
+	}
+	return
+}
+
+func parseSortMode(mode string) (sortType, error) {
+	switch mode {
+	case "", "lex":
+		return sortLex, nil
+	case "num":
+		return sortNum, nil
+	case "nat":
+		return sortNat, nil
+	default:
+		return sortNone, fmt.Errorf("unknown sort mode %q", mode)
+	}
+}
+
+// parseSortOrder parses a runtime sort order, see SetSortOrder(). The
+// mode defaults to the column's sort tag, or lex
+func parseSortOrder(c Columns, spec string) (keys []sortKey, err error) {
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		var k sortKey
+		switch s[0] {
+		case '-':
+			k.desc = true
+			s = s[1:]
+		case '+':
+			s = s[1:]
+		}
+		name, mode := s, ""
+		if i := strings.LastIndexByte(s, ':'); i != -1 {
+			name, mode = s[:i], s[i+1:]
+		}
+		if k.column = columnKey(c, name); k.column == "" {
+			return nil, fmt.Errorf("sort order %q: unknown column %q", spec, name)
+		}
+		k.mode = c[k.column].sort
+		if mode != "" || k.mode == sortNone {
+			if k.mode, err = parseSortMode(mode); err != nil {
+				return nil, fmt.Errorf("sort order %q: %w", spec, err)
+			}
+		}
+		keys = append(keys, k)
+	}
+	return
+}
+
+// columnKey returns the key in Columns for a display name or key, or an
+// empty string if there is no such column
+func columnKey(c Columns, name string) string {
+	if _, ok := c[name]; ok {
+		return name
+	}
+	for k, v := range c {
+		if v.name == name {
+			return k
+		}
+	}
+	return ""
+}
+
+// sortKeys returns the runtime sort order or else the tagged columns in
+// priority then field order, with any sort column moved to the front
+func (l *layout) sortKeys() (keys []sortKey) {
+	if l.sortorder != nil {
+		return l.sortorder
+	}
+	type tagged struct {
+		sortKey
+		priority, number int
+	}
+	var t []tagged
+	for k, c := range l.columns {
+		if c.sort != sortNone {
+			t = append(t, tagged{sortKey{k, c.sortdesc, c.sort}, c.sortpriority, c.number})
+		}
+	}
+	sort.Slice(t, func(a, b int) bool {
+		if t[a].priority != t[b].priority {
+			return t[a].priority < t[b].priority
+		}
+		return t[a].number < t[b].number
+	})
+	for _, k := range t {
+		keys = append(keys, k.sortKey)
+	}
+	if l.sortcolumn == "" || (len(keys) > 0 && keys[0].column == l.sortcolumn) {
+		return
+	}
+	first := sortKey{column: l.sortcolumn, mode: sortLex}
+	for i, k := range keys {
+		if k.column == l.sortcolumn {
+			first = k
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	return append([]sortKey{first}, keys...)
+}
+
+// SetSortOrder sets the sort order at runtime, overriding the sort
+// tags and sort column. The order is a comma separated list of
+// [+|-]COLUMN[:num|nat|lex], e.g. "-cpu:num,name:nat". An empty order
+// reverts to the tags.
+func (l *layout) SetSortOrder(order string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.setSortOrder(order)
+}
+
+func (l *layout) setSortOrder(order string) (err error) {
+	if order == "" {
+		l.sortorder = nil
+		return
+	}
+	keys, err := parseSortOrder(l.columns, order)
+	if err != nil {
+		return
+	}
+	l.sortorder = keys
+	return
+}
+
+// SortOrder returns the sort order in the same form as SetSortOrder()
+func (l *layout) SortOrder() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var parts []string
+	for _, k := range l.sortKeys() {
+		s := k.column
+		if name := l.columns[k.column].name; name != "" && name != "OMIT" {
+			s = name
+		}
+		if k.desc {
+			s = "-" + s
+		}
+		switch k.mode {
+		case sortNum:
+			s += ":num"
+		case sortNat:
+			s += ":nat"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ",")
+}
+
+// SetSortParameter sets the name of a sampler parameter holding a sort
+// order for SetSortOrder(). An empty value reverts to the tags.
+func (l *layout) SetSortParameter(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sortparam = name
+	l.sortparamvalue = ""
+	l.paramsread = time.Time{}
+}
+
+// refreshSortParameter applies the sort parameter if it has changed.
+// Errors are logged and leave the order as it was.
+func (l *layout) refreshSortParameter(parameter func(string) (string, error)) {
+	if l.sortparam == "" {
+		return
+	}
+	value, err := parameter(l.sortparam)
+	if err != nil {
+		ErrorLogger.Printf("sort parameter %q: %v", l.sortparam, err)
+		return
+	}
+	if value == l.sortparamvalue {
+		return
+	}
+	if err = l.setSortOrder(value); err != nil {
+		ErrorLogger.Printf("sort parameter %q: %v", l.sortparam, err)
+		return
+	}
+	l.sortparamvalue = value
+}
+
+// sortRows sorts rows, and vals if not nil, by keys and then the row
+// name, so the order is the same on each update
+func (e *encoder) sortRows(rows [][]string, vals [][]interface{}, keys []sortKey) ([][]string, [][]interface{}) {
+	type cellKey struct {
+		cell int
+		desc bool
+		mode sortType
+		nums []float64
+	}
+	var ck []cellKey
+	for _, k := range keys {
+		c := cellKey{cell: e.cell(k.column), desc: k.desc, mode: k.mode}
+		if c.cell == -1 {
+			continue
+		}
+		// parse numeric keys once rather than in every comparison
+		if c.mode == sortNum {
+			c.nums = make([]float64, len(rows))
+			for i := range rows {
+				c.nums[i] = parseNumber(rows[i][c.cell])
+			}
+		}
+		ck = append(ck, c)
+	}
+	if len(ck) == 0 {
+		return rows, vals
+	}
+	ck = append(ck, cellKey{cell: 0, mode: sortLex})
+
+	// sort a permutation so the parsed keys stay in step with the rows
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra, rb := order[a], order[b]
+		for _, c := range ck {
+			var cmp int
+			switch c.mode {
+			case sortNum:
+				switch {
+				case c.nums[ra] < c.nums[rb]:
+					cmp = -1
+				case c.nums[ra] > c.nums[rb]:
+					cmp = 1
+				default:
+					cmp = strings.Compare(rows[ra][c.cell], rows[rb][c.cell])
+				}
+			case sortNat:
+				cmp = naturalCompare(rows[ra][c.cell], rows[rb][c.cell])
+			default:
+				cmp = strings.Compare(rows[ra][c.cell], rows[rb][c.cell])
+			}
+			if cmp != 0 {
+				return (cmp < 0) != c.desc
+			}
+		}
+		return false
+	})
+	sorted := make([][]string, len(rows))
+	for i, r := range order {
+		sorted[i] = rows[r]
+	}
+	if vals != nil {
+		sortedvals := make([][]interface{}, len(vals))
+		for i, r := range order {
+			sortedvals[i] = vals[r]
+		}
+		vals = sortedvals
+	}
+	return sorted, vals
+}
+
+// parseNumber parses a cell for a numeric sort, including those from
+// unit=auto, e.g. "1.5 GiB" or "1m30s". Anything else is zero.
+func parseNumber(cell string) float64 {
+	if n, err := strconv.ParseFloat(cell, 64); err == nil {
+		return n
+	}
+	if i := strings.LastIndexByte(cell, ' '); i != -1 {
+		n, err := strconv.ParseFloat(cell[:i], 64)
+		if err == nil {
+			for _, u := range iecUnits {
+				if cell[i+1:] == u {
+					return n
+				}
+				n *= 1024
+			}
+		}
+	}
+	if d, err := time.ParseDuration(cell); err == nil {
+		return float64(d)
+	}
+	return 0
+}
+
+// naturalCompare compares a and b treating runs of digits as numbers,
+// so that "cpu2" sorts before "cpu10"
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		ad, bd := isDigit(a[0]), isDigit(b[0])
+		if ad && bd {
+			i, j := digits(a), digits(b)
+			na, nb := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(na) != len(nb) {
+				if len(na) < len(nb) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// digits returns the length of the run of digits at the start of s
+func digits(s string) (i int) {
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return
+}
@@ -0,0 +1,109 @@
+package samplers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"cpu2", "cpu10", -1},
+		{"cpu10", "cpu2", 1},
+		{"cpu02", "cpu2", 0},
+		{"a", "b", -1},
+		{"disk1p2", "disk1p10", -1},
+		{"x", "x1", -1},
+		{"", "", 0},
+		{"10", "9a", 1},
+	}
+	for _, tt := range tests {
+		got := naturalCompare(tt.a, tt.b)
+		if (got < 0) != (tt.want < 0) || (got > 0) != (tt.want > 0) {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		cell string
+		want float64
+	}{
+		{"12.5", 12.5},
+		{"-3", -3},
+		{"1.5 KiB", 1536},
+		{"2 MiB", 2 << 20},
+		{"1m30s", 90e9},
+		{"n/a", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := parseNumber(tt.cell); got != tt.want {
+			t.Errorf("parseNumber(%q) = %v, want %v", tt.cell, got, tt.want)
+		}
+	}
+}
+
+type sortRow struct {
+	Name string  `column:"name"`
+	Zone string  `column:"zone,sort=nat:0"`
+	Load float64 `column:"load,sort=-num:1"`
+	Note string  `column:"note"`
+}
+
+func TestSortOrder(t *testing.T) {
+	data := map[string]sortRow{
+		"a": {"a", "z10", 1, "x"},
+		"b": {"b", "z2", 5, "y"},
+		"c": {"c", "z2", 7, "x"},
+		"d": {"d", "z10", 1, "y"},
+		"e": {"e", "z2", 5, "x"},
+	}
+	tests := []struct {
+		order     string // for SetSortOrder(), empty for the tags
+		want      []string
+		wantOrder string
+		wantErr   bool
+	}{
+		{"", []string{"c", "b", "e", "a", "d"}, "zone:nat,-load:num", false},
+		{"-zone:nat,name", []string{"a", "d", "b", "c", "e"}, "-zone:nat,name", false},
+		{"note,-load", []string{"c", "e", "a", "b", "d"}, "note,-load:num", false},
+		{"load:lex", []string{"a", "d", "b", "e", "c"}, "load", false},
+		{"nosuch", nil, "", true},
+		{"zone:bogus", nil, "", true},
+	}
+	for _, tt := range tests {
+		v := testView(t, sortRow{})
+		err := v.SetSortOrder(tt.order)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("SetSortOrder(%q): no error", tt.order)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("SetSortOrder(%q): %v", tt.order, err)
+		}
+		if got := v.SortOrder(); got != tt.wantOrder {
+			t.Errorf("SetSortOrder(%q): SortOrder() = %q, want %q", tt.order, got, tt.wantOrder)
+		}
+		// maps are unordered, so the result must be the same every time
+		for i := 0; i < 5; i++ {
+			rows, err := v.RowsFromMap(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range rows {
+				got = append(got, r[0])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SetSortOrder(%q): rows %q, want %q", tt.order, got, tt.want)
+				break
+			}
+		}
+	}
+}
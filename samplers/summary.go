@@ -0,0 +1,197 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// aggregate is how a column is summarised in the summary row
+type aggregate int
+
+const (
+	aggNone aggregate = iota
+	aggSum
+	aggAvg
+	aggMin
+	aggMax
+	aggCount
+)
+
+func parseAggregate(s string) (aggregate, error) {
+	switch s {
+	case "sum":
+		return aggSum, nil
+	case "avg":
+		return aggAvg, nil
+	case "min":
+		return aggMin, nil
+	case "max":
+		return aggMax, nil
+	case "count":
+		return aggCount, nil
+	}
+	return aggNone, fmt.Errorf("unknown summary %q", s)
+}
+
+// SummaryPosition is where the summary row is placed in the table
+type SummaryPosition int
+
+const (
+	SummaryLast  SummaryPosition = iota // after all the other rows, the default
+	SummaryFirst                        // before all the other rows
+	SummaryNone                         // no summary row
+)
+
+// DefaultSummaryName is the row name of the summary row unless changed
+// with SetSummaryRow()
+const DefaultSummaryName = "_Total"
+
+/*
+SetSummaryRow sets the row name and position of the summary row. A
+summary row is added to tables when any column has a summary= tag and
+is placed first or last whatever the sort order. An empty name means
+DefaultSummaryName and SummaryNone turns the row off.
+*/
+func (l *layout) SetSummaryRow(name string, position SummaryPosition) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.summaryname = name
+	l.summarypos = position
+}
+
+// SummaryRow returns the row name and position of the summary row
+func (l *layout) SummaryRow() (string, SummaryPosition) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.summaryRow()
+}
+
+func (l *layout) summaryRow() (string, SummaryPosition) {
+	if l.summaryname == "" {
+		return DefaultSummaryName, l.summarypos
+	}
+	return l.summaryname, l.summarypos
+}
+
+// summary accumulates the values of the fields of each row for the
+// columns with a summary tag
+type summary struct {
+	enc   *encoder
+	count []int // rows with a value
+	nums  []int // rows with a numeric value
+	sum   []float64
+	min   []float64
+	max   []float64
+}
+
+// newSummary returns a summary of vals, the values of rows of enc
+func newSummary(enc *encoder, vals [][]interface{}) *summary {
+	n := len(enc.fields)
+	s := &summary{enc: enc, count: make([]int, n), nums: make([]int, n), sum: make([]float64, n),
+		min: make([]float64, n), max: make([]float64, n)}
+	for i := range s.min {
+		s.min[i], s.max[i] = math.Inf(1), math.Inf(-1)
+	}
+	for _, v := range vals {
+		s.add(v)
+	}
+	return s
+}
+
+// add adds the values of one row, as collected by the encoder
+func (s *summary) add(vals []interface{}) {
+	for i, f := range s.enc.fields {
+		if f.column.summary == aggNone || vals[i] == nil {
+			continue
+		}
+		s.count[i]++
+		n, ok := vals[i].(float64)
+		if !ok {
+			continue
+		}
+		s.nums[i]++
+		s.sum[i] += n
+		s.min[i] = math.Min(s.min[i], n)
+		s.max[i] = math.Max(s.max[i], n)
+	}
+}
+
+// row renders the summary row. Only count applies to values that are not
+// numbers, the other aggregates are empty cells if there are no numbers.
+func (s *summary) row(name string) (cells []string, err error) {
+	cells = make([]string, s.enc.cells)
+	if s.enc.cells > 0 {
+		cells[0] = name
+	}
+	for i := range s.enc.fields {
+		f := &s.enc.fields[i]
+		if f.cell <= 0 || f.column.summary == aggNone {
+			continue
+		}
+		var value float64
+		switch f.column.summary {
+		case aggCount:
+			cells[f.cell] = strconv.Itoa(s.count[i])
+			continue
+		case aggSum:
+			if s.nums[i] == 0 {
+				continue
+			}
+			value = s.sum[i]
+		case aggAvg:
+			if s.nums[i] == 0 {
+				continue
+			}
+			value = s.sum[i] / float64(s.nums[i])
+		case aggMin:
+			value = s.min[i]
+		case aggMax:
+			value = s.max[i]
+		}
+		if math.IsInf(value, 0) {
+			continue
+		}
+		if cells[f.cell], err = f.renderAggregate(f.column.summary, value); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// renderAggregate renders a summary or window aggregate of the column.
+// Whole values of integer columns are rendered as integers, by
+// renderFloat(), but an average that isn't whole is rendered as a float
+// to two decimal places, or the column precision, if the column format
+// only takes integers, e.g. %d, as rounding would hide it.
+func (f *fieldEncoder) renderAggregate(fn aggregate, value float64) (string, error) {
+	switch {
+	case fn == aggCount:
+		return strconv.Itoa(int(value)), nil
+	case fn == aggAvg && value != math.Trunc(value) && f.column.unit == "" &&
+		len(f.verbs) == 1 && !verbSuits(f.verbs[0], float64Type, map[reflect.Type]bool{}):
+		prec := f.column.precision
+		if prec == -1 {
+			prec = 2
+		}
+		return strconv.FormatFloat(value, 'f', prec, 64), nil
+	}
+	return f.renderFloat(value)
+}
+
+// addSummary places the summary row, if any, before or after rows
+func (l *layout) addSummary(rows [][]string, s *summary) ([][]string, error) {
+	if s == nil {
+		return rows, nil
+	}
+	name, position := l.summaryRow()
+	row, err := s.row(name)
+	if err != nil {
+		return nil, err
+	}
+	if position == SummaryFirst {
+		return append([][]string{row}, rows...), nil
+	}
+	return append(rows, row), nil
+}
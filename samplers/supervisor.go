@@ -0,0 +1,205 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"wonderland.org/geneos/streams"
+)
+
+/*
+RestartPolicy controls how a sampler is restarted after a panic in
+either InitSampler() or DoSample().
+
+After a panic the sampler waits for Backoff, which is doubled after each
+restart up to MaxBackoff, before calling InitSampler() again and then
+resuming the normal DoSample() schedule. If there have already been
+MaxRestarts restarts in the last Period then the sampler is stopped
+instead.
+*/
+type RestartPolicy struct {
+	MaxRestarts int
+	Period      time.Duration
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// DefaultRestartPolicy is used by samplers unless SetRestartPolicy() is called
+var DefaultRestartPolicy = RestartPolicy{
+	MaxRestarts: 5,
+	Period:      5 * time.Minute,
+	Backoff:     1 * time.Second,
+	MaxBackoff:  1 * time.Minute,
+}
+
+// errStopped is returned by run() when Stop() is called
+var errStopped = errors.New("stopped")
+
+// statusHeadline is the name of the headline used to publish the
+// failure and restart status of a sampler
+const statusHeadline = "samplerStatus"
+
+// PanicError is returned in place of a panic recovered from a plugin
+// method and carries the stack trace from the point of the panic
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// SetRestartPolicy replaces the DefaultRestartPolicy for this sampler
+func (p *Samplers) SetRestartPolicy(policy RestartPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.restartpolicy = &policy
+}
+
+// RestartPolicy returns the restart policy of the sampler
+func (p *Samplers) RestartPolicy() RestartPolicy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.restartpolicy == nil {
+		return DefaultRestartPolicy
+	}
+	return *p.restartpolicy
+}
+
+// SetStream sets an optional stream that the sampler writes failure
+// reports to, including stack traces, as well as the error log. The
+// stream name must already have been set using SetStreamName()
+func (p *Samplers) SetStream(stream *streams.Stream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stream = stream
+}
+
+// Stream returns the stream set with SetStream(), if any
+func (p *Samplers) Stream() *streams.Stream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stream
+}
+
+// protect calls f and turns any panic into a *PanicError
+func protect(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f()
+}
+
+// run calls DoSample() every interval until it returns an error or
+// panics, or stop is closed. The interval defaults to, and cannot be less
+// than, one second
+func (p *Samplers) run(stop <-chan struct{}) error {
+	interval := p.sampleInterval()
+	tick := p.Clock().NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C():
+		case <-stop:
+			return errStopped
+		}
+		if err := protect(p.doSampleInterval); err != nil {
+			return err
+		}
+		// pick up any SetInterval() since the last sample
+		if i := p.sampleInterval(); i != interval {
+			interval = i
+			tick.Reset(interval)
+		}
+	}
+}
+
+func (p *Samplers) sampleInterval() time.Duration {
+	if interval := p.Interval(); interval >= time.Second {
+		return interval
+	}
+	return time.Second
+}
+
+// supervise runs the sampler and restarts it after any panic, subject
+// to the restart policy. err is the result of the first InitSampler(),
+// which is either nil or a panic. Ordinary errors returned from
+// DoSample() or a later InitSampler() stop the sampler as before.
+func (p *Samplers) supervise(stop <-chan struct{}, err error) {
+	policy := p.RestartPolicy()
+	clock := p.Clock()
+	backoff := policy.Backoff
+	var restarts []time.Time
+
+	if err == nil {
+		err = p.run(stop)
+	}
+	for {
+		if err == errStopped {
+			return
+		}
+		perr, ok := err.(*PanicError)
+		if !ok {
+			ErrorLogger.Printf("sampler %q stopped: %v", p.ToString(), err)
+			return
+		}
+		p.reportPanic(perr)
+
+		now := clock.Now()
+		recent := restarts[:0]
+		for _, t := range restarts {
+			if now.Sub(t) < policy.Period {
+				recent = append(recent, t)
+			}
+		}
+		restarts = recent
+		if len(restarts) == 0 {
+			backoff = policy.Backoff
+		}
+		if len(restarts) >= policy.MaxRestarts {
+			p.publishStatus(fmt.Sprintf("FAILED: %d restarts in %v, last %v", len(restarts), policy.Period, perr))
+			return
+		}
+		restarts = append(restarts, now)
+
+		p.publishStatus(fmt.Sprintf("RESTARTING in %v after %v", backoff, perr))
+		select {
+		case <-clock.After(backoff):
+		case <-stop:
+			return
+		}
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+
+		if err = protect(p.initSamplerInternal); err != nil {
+			continue
+		}
+		p.publishStatus("OK")
+		err = p.run(stop)
+	}
+}
+
+// reportPanic writes the panic and stack trace to the error log and,
+// if set, the sampler stream
+func (p *Samplers) reportPanic(perr *PanicError) {
+	msg := fmt.Sprintf("sampler %q recovered %v\n%s", p.ToString(), perr, perr.Stack)
+	ErrorLogger.Print(msg)
+	if stream := p.Stream(); stream != nil {
+		if _, err := stream.WriteString(msg); err != nil {
+			ErrorLogger.Print(err)
+		}
+	}
+}
+
+// publishStatus updates the sampler status headline on the dataview
+func (p *Samplers) publishStatus(status string) {
+	if err := p.Headline(statusHeadline, status); err != nil {
+		ErrorLogger.Print(err)
+	}
+}
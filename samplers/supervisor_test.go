@@ -0,0 +1,152 @@
+package samplers_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/samplers"
+	"wonderland.org/geneos/samplertest"
+)
+
+var errTest = errors.New("test error")
+
+// panicky panics in InitSampler() until it has been called initPanics
+// times, and in every DoSample() if samplePanics is set
+type panicky struct {
+	samplers.Samplers
+	initPanics   int32
+	initErr      error
+	samplePanics bool
+
+	inits, samples int32
+}
+
+func (p *panicky) InitSampler() error {
+	if atomic.AddInt32(&p.inits, 1) <= p.initPanics {
+		panic("init")
+	}
+	return p.initErr
+}
+
+func (p *panicky) DoSample() error {
+	atomic.AddInt32(&p.samples, 1)
+	if p.samplePanics {
+		panic("boom")
+	}
+	return nil
+}
+
+// waitFor polls cond until it is true or a few seconds have passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	policy := samplers.RestartPolicy{MaxRestarts: 2, Period: time.Hour, Backoff: time.Second, MaxBackoff: 1500 * time.Millisecond}
+	type step struct {
+		advance time.Duration // then wait for status
+		status  string        // prefix of samplerStatus
+	}
+	tests := []struct {
+		name        string
+		plugin      *panicky
+		wantStart   string // error from Start()
+		steps       []step
+		wantSamples int32
+		stopped     bool // the supervisor gives up by itself
+	}{
+		{
+			name:   "DoSample panics",
+			plugin: &panicky{samplePanics: true},
+			steps: []step{
+				{10 * time.Second, "RESTARTING in 1s after panic: boom"},
+				{time.Second, "OK"},
+				{10 * time.Second, "RESTARTING in 1.5s after panic: boom"},
+				{1500 * time.Millisecond, "OK"},
+				{10 * time.Second, "FAILED: 2 restarts in 1h0m0s, last panic: boom"},
+			},
+			wantSamples: 3,
+			stopped:     true,
+		},
+		{
+			name:   "first InitSampler panics",
+			plugin: &panicky{initPanics: 1},
+			steps: []step{
+				{0, "RESTARTING in 1s after panic: init"},
+				{time.Second, "OK"},
+				{10 * time.Second, "OK"},
+			},
+			wantSamples: 1,
+		},
+		{
+			name:      "InitSampler error",
+			plugin:    &panicky{initErr: errTest},
+			wantStart: errTest.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := samplertest.NewNetprobe()
+			conn, err := n.Connection(samplertest.Entity, samplertest.Sampler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := tt.plugin
+			p.Plugins = p
+			if err = p.New(conn, "test", "SYSTEM"); err != nil {
+				t.Fatal(err)
+			}
+			clock := n.Clock()
+			p.SetClock(clock)
+			p.SetInterval(10 * time.Second)
+			p.SetRestartPolicy(policy)
+
+			var wg sync.WaitGroup
+			err = p.Start(&wg)
+			if tt.wantStart != "" {
+				if err == nil || err.Error() != tt.wantStart {
+					t.Fatalf("Start() = %v, want %s", err, tt.wantStart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Start() = %v", err)
+			}
+			status := func() string {
+				d, ok := n.Dataview(samplertest.Entity, samplertest.Sampler, "test", "SYSTEM")
+				if !ok {
+					return ""
+				}
+				s, _ := d.Headline("samplerStatus")
+				return s
+			}
+			for _, s := range tt.steps {
+				if s.advance > 0 {
+					clock.BlockUntil(1)
+					clock.Advance(s.advance)
+				}
+				// the old ticker or timer has gone by the time the status
+				// changes, so BlockUntil() above waits for the new one
+				waitFor(t, s.status, func() bool { return strings.HasPrefix(status(), s.status) })
+			}
+			waitFor(t, "samples", func() bool { return atomic.LoadInt32(&p.samples) == tt.wantSamples })
+			if !tt.stopped {
+				p.Stop()
+			}
+			wg.Wait()
+			if got := atomic.LoadInt32(&p.samples); got != tt.wantSamples {
+				t.Errorf("DoSample() called %d times, want %d", got, tt.wantSamples)
+			}
+		})
+	}
+}
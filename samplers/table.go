@@ -0,0 +1,148 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+/*
+Table is a typed alternative to the interface{} based helpers on View.
+
+The Columns, column names and sort column are derived once from the
+struct tags of T when the Table is created and updates only accept
+slices or maps of T, so mismatched data is caught at compile time.
+Unlike the older helpers every conversion error is returned.
+
+	t, err := samplers.NewTable[CPUStats](p.View)
+	...
+	err = samplers.UpdateTableFromMap(t, stats)
+*/
+type Table[T any] struct {
+	view *View
+	layout
+}
+
+// NewTable returns a Table that publishes rows of T, which must be a
+// struct, to the View v
+func NewTable[T any](v *View) (t *Table[T], err error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		err = fmt.Errorf("NewTable(): %v is not a struct", rt)
+		return
+	}
+	columns, columnnames, sortcol, err := v.ColumnInfo(reflect.New(rt).Elem().Interface())
+	if err != nil {
+		return
+	}
+	t = &Table[T]{
+		view: v,
+		layout: layout{
+			columns:     columns,
+			columnnames: columnnames,
+			sortcolumn:  sortcol,
+			encoders:    newEncoders(columns),
+			clock:       v.Clock(),
+		},
+	}
+	v.mu.Lock()
+	v.tables = append(v.tables, &t.layout)
+	v.mu.Unlock()
+	return
+}
+
+// View returns the View that the Table is published to
+func (t *Table[T]) View() *View {
+	return t.view
+}
+
+func (t *Table[T]) Columns() Columns {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.columns
+}
+
+func (t *Table[T]) ColumnNames() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.columnnames
+}
+
+func (t *Table[T]) SetSortColumn(column string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sortcolumn = column
+}
+
+func (t *Table[T]) SortColumn() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sortcolumn
+}
+
+// SetRowNamesFromKeys controls whether map keys are used as row names,
+// see View.SetRowNamesFromKeys()
+func (t *Table[T]) SetRowNamesFromKeys(keys bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.keyrownames = keys
+}
+
+// RowsFromSlice renders the rows in the order given
+func (t *Table[T]) RowsFromSlice(data []T) ([][]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rowsFromSlice(reflect.ValueOf(data), false)
+}
+
+// UpdateTableFromSlice replaces the contents of the dataview with data,
+// in the order given
+func (t *Table[T]) UpdateTableFromSlice(data []T) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rows, err := t.rowsFromSlice(reflect.ValueOf(data), true)
+	if err != nil {
+		return err
+	}
+	return t.publish(t.view.Dataview, rows)
+}
+
+// RowsFromMap renders the values of data sorted by the sort column of
+// the Table. The map keys are only used if SetRowNamesFromKeys(true)
+func RowsFromMap[K comparable, T any](t *Table[T], data map[K]T) ([][]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rowsFromMap(reflect.ValueOf(data), false)
+}
+
+// UpdateTableFromMap replaces the contents of the dataview with the
+// values of data, sorted by the sort column of the Table
+func UpdateTableFromMap[K comparable, T any](t *Table[T], data map[K]T) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rows, err := t.rowsFromMap(reflect.ValueOf(data), true)
+	if err != nil {
+		return err
+	}
+	return t.publish(t.view.Dataview, rows)
+}
+
+// RowsFromMapDelta renders the difference between newdata and olddata,
+// scaled by interval, in the same way as View.RowsFromMapDelta()
+func RowsFromMapDelta[K comparable, T any](t *Table[T], newdata, olddata map[K]T, interval time.Duration) ([][]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rowsFromMapDelta(reflect.ValueOf(newdata), reflect.ValueOf(olddata), interval, false)
+}
+
+// UpdateTableFromMapDelta replaces the contents of the dataview with
+// the difference between newdata and olddata, scaled by interval
+func UpdateTableFromMapDelta[K comparable, T any](t *Table[T], newdata, olddata map[K]T, interval time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rows, err := t.rowsFromMapDelta(reflect.ValueOf(newdata), reflect.ValueOf(olddata), interval, true)
+	if err != nil {
+		return err
+	}
+	return t.publish(t.view.Dataview, rows)
+}
@@ -0,0 +1,157 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"time"
+
+	"wonderland.org/geneos/xmlrpc"
+)
+
+/*
+View is a dataview owned by a sampler along with the settings used to
+render tables into it - the Columns, the column names and the sort column.
+
+Every sampler has a default View, named after the sampler, which is
+created by New() and embedded in Samplers. Plugins that publish more than
+one dataview from each collection pass, e.g. a summary and a detail view,
+can add more with AddView() and update them all from the same DoSample()
+*/
+type View struct {
+	*xmlrpc.Dataview
+	layout
+	headlines *headlines
+	tables    []*layout // of the Tables published to the view, guarded by mu
+}
+
+// AddView creates a new dataview on the sampler's connection and
+// returns it. The name must be unique within the sampler.
+func (s *Samplers) AddView(name string, group string) (v *View, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.viewByName(name) != nil {
+		err = fmt.Errorf("AddView(): dataview %q already exists", name)
+		return
+	}
+	d, err := s.connection.NewDataview(name, group)
+	if err != nil {
+		return
+	}
+	v = &View{Dataview: d}
+	v.clock = s.clock
+	s.views = append(s.views, v)
+	return
+}
+
+// RemoveView closes the named dataview and removes it from the sampler.
+// The default view cannot be removed, use Close() instead.
+func (s *Samplers) RemoveView(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range s.views {
+		if v.viewName() != name {
+			continue
+		}
+		if v == s.View {
+			return fmt.Errorf("RemoveView(): cannot remove default dataview %q", name)
+		}
+		s.views = append(s.views[:i], s.views[i+1:]...)
+		return v.Dataview.Close()
+	}
+	return fmt.Errorf("RemoveView(): dataview %q not found", name)
+}
+
+// ViewByName returns the named View or nil if it is not found
+func (s *Samplers) ViewByName(name string) *View {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.viewByName(name)
+}
+
+func (s *Samplers) viewByName(name string) *View {
+	for _, v := range s.views {
+		if v.viewName() == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// Views returns all the Views of the sampler, in the order they were
+// added. The first is always the default View.
+func (s *Samplers) Views() []*View {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*View{}, s.views...)
+}
+
+// refreshParameters refreshes the sampler parameters of the view and of
+// the Tables published to it, see layout.refreshParameters()
+func (v *View) refreshParameters(interval time.Duration) {
+	v.layout.refreshParameters(v.Parameter, interval)
+	v.mu.Lock()
+	tables := append([]*layout{}, v.tables...)
+	v.mu.Unlock()
+	for _, t := range tables {
+		t.refreshParameters(v.Parameter, interval)
+	}
+}
+
+func (v *View) viewName() string {
+	name, _ := v.DataviewGroupNames()
+	return name
+}
+
+func (v *View) SetColumnNames(columnnames []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.columnnames = columnnames
+	return
+}
+
+func (v *View) ColumnNames() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.columnnames
+}
+
+func (v *View) SetColumns(columns Columns) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.columns = columns
+	v.encoders = newEncoders(columns)
+	return
+}
+
+func (v *View) Columns() Columns {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.columns
+}
+
+func (v *View) SetSortColumn(column string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.sortcolumn = column
+	return
+}
+
+func (v *View) SortColumn() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.sortcolumn
+}
+
+// SetRowNamesFromKeys controls whether the keys of maps passed to the
+// map based helpers are used as row names, replacing the value of the
+// row name column. The default is false.
+func (v *View) SetRowNamesFromKeys(keys bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.keyrownames = keys
+}
+
+func (v *View) RowNamesFromKeys() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.keyrownames
+}
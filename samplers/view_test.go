@@ -0,0 +1,87 @@
+package samplers_test
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/samplertest"
+)
+
+func TestViews(t *testing.T) {
+	n, p := newSampler(t)
+	dataviews := func() []string {
+		names := n.Dataviews(samplertest.Entity, samplertest.Sampler)
+		sort.Strings(names)
+		return names
+	}
+	if got := dataviews(); !reflect.DeepEqual(got, []string{"SYSTEM-test"}) {
+		t.Fatalf("dataviews %q after New()", got)
+	}
+
+	detail, err := p.AddView("detail", "SYSTEM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.AddView("detail", "OTHER"); err == nil {
+		t.Error("AddView() of a duplicate name: no error")
+	}
+	if _, err = p.AddView("test", "OTHER"); err == nil {
+		t.Error("AddView() with the name of the default view: no error")
+	}
+	if _, err = p.AddView("extra", "OTHER"); err != nil {
+		t.Fatal(err)
+	}
+	if got := dataviews(); !reflect.DeepEqual(got, []string{"OTHER-extra", "SYSTEM-detail", "SYSTEM-test"}) {
+		t.Errorf("dataviews %q after AddView()", got)
+	}
+	if views := p.Views(); len(views) != 3 || views[0] != p.View || views[1] != detail {
+		t.Errorf("Views() = %v", views)
+	}
+	if p.ViewByName("detail") != detail || p.ViewByName("nosuch") != nil {
+		t.Error("ViewByName() did not find the views")
+	}
+
+	if err = p.RemoveView("nosuch"); err == nil {
+		t.Error("RemoveView() of an unknown view: no error")
+	}
+	if err = p.RemoveView("test"); err == nil {
+		t.Error("RemoveView() of the default view: no error")
+	}
+	if err = p.RemoveView("detail"); err != nil {
+		t.Fatal(err)
+	}
+	if p.ViewByName("detail") != nil {
+		t.Error("ViewByName() found a removed view")
+	}
+	if err = p.RemoveView("detail"); err == nil {
+		t.Error("RemoveView() twice: no error")
+	}
+	if got := dataviews(); !reflect.DeepEqual(got, []string{"OTHER-extra", "SYSTEM-test"}) {
+		t.Errorf("dataviews %q after RemoveView()", got)
+	}
+	// the name can be used again
+	if _, err = p.AddView("detail", "SYSTEM"); err != nil {
+		t.Errorf("AddView() after RemoveView(): %v", err)
+	}
+
+	// Stop() leaves the views, Close() removes them all
+	p.SetInterval(time.Second)
+	var wg sync.WaitGroup
+	if err = p.Start(&wg); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	wg.Wait()
+	if got := dataviews(); len(got) != 3 {
+		t.Errorf("dataviews %q after Stop()", got)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dataviews(); len(got) != 0 {
+		t.Errorf("dataviews %q after Close()", got)
+	}
+}
@@ -0,0 +1,222 @@
+package samplers // import "wonderland.org/geneos/samplers"
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// window is a rolling-window aggregation of a column over the last
+// count samples or the samples in the last span of time
+type window struct {
+	fn    aggregate
+	count int
+	span  time.Duration
+}
+
+// parseWindow parses the value of a window= tag, FUNC:N or FUNC:DURATION
+func parseWindow(s string) (w *window, err error) {
+	i := strings.IndexByte(s, ':')
+	if i == -1 {
+		return nil, fmt.Errorf("window %q must be FUNC:N or FUNC:DURATION", s)
+	}
+	w = &window{}
+	if w.fn, err = parseAggregate(s[:i]); err != nil {
+		return nil, fmt.Errorf("unknown window function %q", s[:i])
+	}
+	if w.count, err = strconv.Atoi(s[i+1:]); err == nil {
+		if w.count < 1 {
+			return nil, fmt.Errorf("window %q must be at least one sample", s)
+		}
+		return
+	}
+	if w.span, err = time.ParseDuration(s[i+1:]); err != nil || w.span <= 0 {
+		return nil, fmt.Errorf("window %q: invalid size %q", s, s[i+1:])
+	}
+	return
+}
+
+// windowSample is one value in a ring
+type windowSample struct {
+	when  time.Time
+	value float64
+}
+
+// ring holds the samples of one column of one row, oldest first from
+// head. Rings for a count are a fixed size, those for a span grow as
+// needed and are pruned by age.
+type ring struct {
+	samples []windowSample
+	head, n int
+}
+
+// push adds a sample, dropping the oldest if the ring is full and
+// limited to count samples
+func (r *ring) push(s windowSample, count int) {
+	if r.n == len(r.samples) {
+		if count > 0 && r.n == count {
+			r.samples[r.head] = s
+			r.head = (r.head + 1) % len(r.samples)
+			return
+		}
+		size := 2 * len(r.samples)
+		if size == 0 {
+			size = 4
+		}
+		if count > 0 && size > count {
+			size = count
+		}
+		samples := make([]windowSample, size)
+		for i := 0; i < r.n; i++ {
+			samples[i] = r.at(i)
+		}
+		r.samples, r.head = samples, 0
+	}
+	r.samples[(r.head+r.n)%len(r.samples)] = s
+	r.n++
+}
+
+// at returns the i'th oldest sample
+func (r *ring) at(i int) windowSample {
+	return r.samples[(r.head+i)%len(r.samples)]
+}
+
+// prune drops samples taken before since
+func (r *ring) prune(since time.Time) {
+	for r.n > 0 && r.samples[r.head].when.Before(since) {
+		r.head = (r.head + 1) % len(r.samples)
+		r.n--
+	}
+}
+
+// aggregate returns fn over the samples, false if there are none
+func (r *ring) aggregate(fn aggregate) (value float64, ok bool) {
+	if r.n == 0 {
+		return
+	}
+	switch fn {
+	case aggMin:
+		value = math.Inf(1)
+	case aggMax:
+		value = math.Inf(-1)
+	}
+	for i := 0; i < r.n; i++ {
+		v := r.at(i).value
+		switch fn {
+		case aggSum, aggAvg:
+			value += v
+		case aggMin:
+			value = math.Min(value, v)
+		case aggMax:
+			value = math.Max(value, v)
+		}
+	}
+	switch fn {
+	case aggAvg:
+		value /= float64(r.n)
+	case aggCount:
+		value = float64(r.n)
+	}
+	return value, true
+}
+
+// clone returns a copy of the ring that can be changed without
+// changing r
+func (r *ring) clone() *ring {
+	c := *r
+	c.samples = append([]windowSample(nil), r.samples...)
+	return &c
+}
+
+// windowKey identifies the ring of one column, so changing the window
+// of a column starts it again while other changes to the Columns don't
+type windowKey struct {
+	column string
+	window window
+}
+
+/*
+windows keeps the rings of the windowed columns of a View or Table,
+keyed by row name. It belongs to the layout, not the encoders, so the
+windows survive changes to the Columns that replace the encoders.
+*/
+type windows struct {
+	rows map[string]map[windowKey]*ring
+}
+
+// applyWindows replaces the value and cell of each windowed column of
+// each row with the aggregate over the window, including the new value.
+// Values that are not numbers, e.g. a rate with no previous sample, are
+// not included. Only if update is true are the new values kept in the
+// rings, and the rings of rows and columns no longer in the table
+// dropped, so that rendering rows without publishing them doesn't move
+// the windows on. The rows have already been checked for unique names.
+// The caller holds the lock.
+func (l *layout) applyWindows(enc *encoder, rows [][]string, vals [][]interface{}, update bool) (err error) {
+	if l.windows == nil {
+		l.windows = &windows{rows: make(map[string]map[windowKey]*ring)}
+	}
+	seen := make(map[string]bool, len(rows))
+	for r, row := range rows {
+		if len(row) == 0 {
+			continue
+		}
+		seen[row[0]] = true
+		rings := l.windows.rows[row[0]]
+		if rings == nil {
+			rings = make(map[windowKey]*ring)
+		}
+		used := make(map[windowKey]*ring, len(rings))
+		for i := range enc.fields {
+			f := &enc.fields[i]
+			if f.column.window == nil {
+				continue
+			}
+			w := f.column.window
+			key := windowKey{f.name, *w}
+			rg := rings[key]
+			switch {
+			case rg == nil:
+				rg = &ring{}
+			case !update:
+				rg = rg.clone()
+			}
+			used[key] = rg
+			if n, ok := vals[r][i].(float64); ok {
+				rg.push(windowSample{enc.now, n}, w.count)
+			}
+			if w.span > 0 {
+				rg.prune(enc.now.Add(-w.span))
+			}
+			value, ok := rg.aggregate(w.fn)
+			if !ok {
+				vals[r][i] = nil
+				if f.cell > 0 {
+					row[f.cell] = ""
+				}
+				continue
+			}
+			vals[r][i] = value
+			if f.cell <= 0 {
+				continue
+			}
+			if row[f.cell], err = f.renderAggregate(w.fn, value); err != nil {
+				return
+			}
+		}
+		if update {
+			l.windows.rows[row[0]] = used
+		}
+	}
+	if !update {
+		return
+	}
+	for name := range l.windows.rows {
+		if !seen[name] {
+			delete(l.windows.rows, name)
+		}
+	}
+	return
+}
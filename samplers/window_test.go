@@ -0,0 +1,190 @@
+package samplers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    window
+		wantErr bool
+	}{
+		{"avg:5", window{fn: aggAvg, count: 5}, false},
+		{"max:1m", window{fn: aggMax, span: time.Minute}, false},
+		{"count:1", window{fn: aggCount, count: 1}, false},
+		{"avg", window{}, true},
+		{"median:5", window{}, true},
+		{"avg:0", window{}, true},
+		{"avg:-1s", window{}, true},
+		{"avg:x", window{}, true},
+	}
+	for _, tt := range tests {
+		w, err := parseWindow(tt.tag)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWindow(%q) error %v", tt.tag, err)
+			continue
+		}
+		if err == nil && *w != tt.want {
+			t.Errorf("parseWindow(%q) = %+v, want %+v", tt.tag, *w, tt.want)
+		}
+	}
+}
+
+func TestRing(t *testing.T) {
+	start := time.Time{}
+	var counted, timed ring
+	for i := 1; i <= 10; i++ {
+		s := windowSample{start.Add(time.Duration(i) * time.Second), float64(i)}
+		counted.push(s, 3)
+		timed.push(s, 0)
+	}
+	timed.prune(start.Add(6 * time.Second))
+	tests := []struct {
+		r    *ring
+		fn   aggregate
+		want float64
+	}{
+		{&counted, aggSum, 27},
+		{&counted, aggAvg, 9},
+		{&counted, aggMin, 8},
+		{&counted, aggCount, 3},
+		{&timed, aggMax, 10},
+		{&timed, aggMin, 6},
+		{&timed, aggCount, 5},
+	}
+	for i, tt := range tests {
+		if got, ok := tt.r.aggregate(tt.fn); !ok || got != tt.want {
+			t.Errorf("%d: aggregate() = %v, %v, want %v", i, got, ok, tt.want)
+		}
+	}
+	if _, ok := (&ring{}).aggregate(aggAvg); ok {
+		t.Error("aggregate() of an empty ring: ok")
+	}
+}
+
+type windowRow struct {
+	Name string   `column:"name,rowname="`
+	Busy float64  `column:"busy,precision=1"`
+	_    struct{} `column:"busyMax,window=max:1m,precision=1" expr:"Busy"`
+	_    struct{} `column:"n,window=count:3" expr:"Busy"`
+}
+
+func TestWindows(t *testing.T) {
+	v := testView(t, windowRow{})
+	clock := NewFakeClock(time.Time{})
+	v.SetClock(clock)
+	if err := v.AddComputedColumn("busyAvg", "busy", "window=avg:2,precision=2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the columns are name, busy, busyMax, n and busyAvg, then any added below
+	tests := []struct {
+		name    string
+		advance time.Duration
+		update  bool
+		setup   func() error
+		data    []windowRow
+		want    [][]string
+	}{
+		{
+			name: "first", advance: 40 * time.Second, update: true,
+			data: []windowRow{{Name: "a", Busy: 10}, {Name: "b", Busy: 1}},
+			want: [][]string{{"a", "10.0", "10.0", "1", "10.00"}, {"b", "1.0", "1.0", "1", "1.00"}},
+		},
+		{
+			name: "second", advance: 40 * time.Second, update: true,
+			data: []windowRow{{Name: "a", Busy: 20}, {Name: "b", Busy: 2}},
+			want: [][]string{{"a", "20.0", "20.0", "2", "15.00"}, {"b", "2.0", "2.0", "2", "1.50"}},
+		},
+		{
+			name: "read only",
+			data: []windowRow{{Name: "a", Busy: 100}},
+			want: [][]string{{"a", "100.0", "100.0", "3", "60.00"}},
+		},
+		{
+			// the read above isn't in the windows, a sample from 80s ago
+			// is out of the max window and row b has gone
+			name: "row missing", advance: 40 * time.Second, update: true,
+			data: []windowRow{{Name: "a", Busy: 5}},
+			want: [][]string{{"a", "5.0", "20.0", "3", "12.50"}},
+		},
+		{
+			name: "row back", advance: 40 * time.Second, update: true,
+			data: []windowRow{{Name: "a", Busy: 6}, {Name: "b", Busy: 3}},
+			want: [][]string{{"a", "6.0", "6.0", "3", "5.50"}, {"b", "3.0", "3.0", "1", "3.00"}},
+		},
+		{
+			name: "columns changed", advance: 40 * time.Second, update: true,
+			setup: func() error { return v.AddComputedColumn("double", "busy*2", "") },
+			data:  []windowRow{{Name: "a", Busy: 7}},
+			want:  [][]string{{"a", "7.0", "7.0", "3", "6.50", "14"}},
+		},
+		{
+			name: "window changed", advance: 40 * time.Second, update: true,
+			setup: func() error {
+				if err := v.RemoveComputedColumn("busyAvg"); err != nil {
+					return err
+				}
+				return v.AddComputedColumn("busyAvg", "busy", "window=avg:3,precision=2")
+			},
+			data: []windowRow{{Name: "a", Busy: 8}},
+			want: [][]string{{"a", "8.0", "8.0", "3", "16", "8.00"}},
+		},
+	}
+	for _, tt := range tests {
+		if tt.setup != nil {
+			if err := tt.setup(); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		clock.Advance(tt.advance)
+		var rows [][]string
+		var err error
+		if tt.update {
+			// as UpdateTableFromSlice(), without a dataview to publish to
+			v.mu.Lock()
+			rows, err = v.rowsFromSlice(reflect.ValueOf(tt.data), true)
+			v.mu.Unlock()
+		} else {
+			rows, err = v.RowsFromSlice(tt.data)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("%s: rows %q, want %q", tt.name, rows, tt.want)
+		}
+	}
+}
+
+// windows over integer fields suit integer formats
+func TestIntegerWindows(t *testing.T) {
+	type row struct {
+		Name  string   `column:"name,rowname="`
+		Ops   int      `column:"ops,format=%d,window=sum:3"`
+		Depth uint32   `column:"depth,format=%d,window=max:1m"`
+		_     struct{} `column:"opsAvg,format=%d,window=avg:3" expr:"Ops"`
+	}
+	v := testView(t, row{})
+	for i, tt := range []struct {
+		data row
+		want []string
+	}{
+		{row{Name: "a", Ops: 1, Depth: 4}, []string{"a", "1", "4", "1"}},
+		{row{Name: "a", Ops: 2, Depth: 2}, []string{"a", "3", "4", "1.50"}},
+		{row{Name: "a", Ops: 6, Depth: 1}, []string{"a", "9", "4", "3"}},
+	} {
+		v.mu.Lock()
+		rows, err := v.rowsFromSlice(reflect.ValueOf([]row{tt.data}), true)
+		v.mu.Unlock()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if !reflect.DeepEqual(rows[0], tt.want) {
+			t.Errorf("%d: got %q, want %q", i, rows[0], tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package samplertest // import "wonderland.org/geneos/samplertest"
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// UpdateEnv is the environment variable that, when set, makes Golden()
+// write golden files rather than compare against them
+const UpdateEnv = "SAMPLERTEST_UPDATE"
+
+// Golden compares got with the contents of the file at path and fails
+// the test, showing the lines that differ, if they are not the same. If
+// UpdateEnv is set the file is written instead.
+func Golden(t testing.TB, path string, got string) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, set %s=1 to create it", err, UpdateEnv)
+	}
+	if string(want) != got {
+		t.Errorf("%s: does not match golden file\n%s", path, diff(string(want), got))
+	}
+}
+
+// diff lists the lines of want and got that differ, by line number
+func diff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	n := len(w)
+	if len(g) > n {
+		n = len(g)
+	}
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			fmt.Fprintf(&b, "%4d - %s\n%4d + %s\n", i+1, wl, i+1, gl)
+		}
+	}
+	return b.String()
+}
+
+// AssertCell fails the test if the cell does not exist or does not have
+// the value want
+func AssertCell(t testing.TB, d *Dataview, row string, column string, want string) {
+	t.Helper()
+	if d == nil {
+		t.Fatal("dataview does not exist")
+	}
+	got, ok := d.Cell(row, column)
+	if !ok {
+		t.Errorf("%s-%s: no cell %s.%s", d.Group, d.Name, row, column)
+		return
+	}
+	if got != want {
+		t.Errorf("%s-%s: cell %s.%s = %q, want %q", d.Group, d.Name, row, column, got, want)
+	}
+}
+
+// AssertHeadline fails the test if the headline does not exist or does
+// not have the value want
+func AssertHeadline(t testing.TB, d *Dataview, name string, want string) {
+	t.Helper()
+	if d == nil {
+		t.Fatal("dataview does not exist")
+	}
+	got, ok := d.Headline(name)
+	if !ok {
+		t.Errorf("%s-%s: no headline %s", d.Group, d.Name, name)
+		return
+	}
+	if got != want {
+		t.Errorf("%s-%s: headline %s = %q, want %q", d.Group, d.Name, name, got, want)
+	}
+}
+
+// AssertRows fails the test unless the dataview has exactly the rows
+// named in want, in that order
+func AssertRows(t testing.TB, d *Dataview, want ...string) {
+	t.Helper()
+	if d == nil {
+		t.Fatal("dataview does not exist")
+	}
+	got := d.RowNames()
+	if strings.Join(got, "\x00") != strings.Join(want, "\x00") || len(got) != len(want) {
+		t.Errorf("%s-%s: rows %q, want %q", d.Group, d.Name, got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package samplertest // import "wonderland.org/geneos/samplertest"
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Dataview is a copy of a dataview held by the Netprobe, taken when it
+// was asked for
+type Dataview struct {
+	Name  string
+	Group string
+	// Columns are the column names, the first is the row name column
+	Columns []string
+	// Rows are in the order they were added, each starting with the row
+	// name and with one cell for each column
+	Rows [][]string
+	// Headlines are in the order they were added
+	Headlines []Headline
+}
+
+// Headline is a dataview headline and its value
+type Headline struct {
+	Name  string
+	Value string
+}
+
+func (v *view) snapshot() *Dataview {
+	d := &Dataview{
+		Name:    v.name,
+		Group:   v.group,
+		Columns: append([]string{}, v.columns...),
+	}
+	for _, name := range v.rows {
+		d.Rows = append(d.Rows, append([]string{name}, v.cells[name]...))
+	}
+	for _, name := range v.headlines {
+		d.Headlines = append(d.Headlines, Headline{name, v.values[name]})
+	}
+	return d
+}
+
+// RowNames returns the row names in order
+func (d *Dataview) RowNames() (names []string) {
+	for _, row := range d.Rows {
+		names = append(names, row[0])
+	}
+	return
+}
+
+// Row returns the named row, starting with the row name, or nil
+func (d *Dataview) Row(name string) []string {
+	for _, row := range d.Rows {
+		if row[0] == name {
+			return row
+		}
+	}
+	return nil
+}
+
+// Cell returns the value of a cell and false if the row or column does
+// not exist
+func (d *Dataview) Cell(row string, column string) (string, bool) {
+	r := d.Row(row)
+	if r == nil {
+		return "", false
+	}
+	for i, c := range d.Columns {
+		if c == column && i < len(r) {
+			return r[i], true
+		}
+	}
+	return "", false
+}
+
+// Column returns the cells of a column in row order, or nil if it does
+// not exist
+func (d *Dataview) Column(column string) (cells []string) {
+	for i, c := range d.Columns {
+		if c != column {
+			continue
+		}
+		cells = []string{}
+		for _, r := range d.Rows {
+			if i < len(r) {
+				cells = append(cells, r[i])
+			} else {
+				cells = append(cells, "")
+			}
+		}
+	}
+	return
+}
+
+// Headline returns the value of a headline and false if it does not
+// exist
+func (d *Dataview) Headline(name string) (string, bool) {
+	for _, h := range d.Headlines {
+		if h.Name == name {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+/*
+String renders the dataview as plain text, for golden files and test
+failures: the group and name, the headlines one per line and then the
+table with columns aligned, e.g.
+
+	SYSTEM-cpu
+	samplerStatus: OK
+	+---------+-------+
+	| cpu     | %busy |
+	+---------+-------+
+	| cpu0    | 12.5  |
+	| cpu1    | 3.0   |
+	+---------+-------+
+*/
+func (d *Dataview) String() string {
+	var b strings.Builder
+	b.WriteString(d.Group + "-" + d.Name + "\n")
+	for _, h := range d.Headlines {
+		b.WriteString(h.Name + ": " + h.Value + "\n")
+	}
+	if len(d.Columns) == 0 {
+		return b.String()
+	}
+
+	widths := make([]int, len(d.Columns))
+	measure := func(cells []string) {
+		for i, c := range cells {
+			if i < len(widths) && utf8.RuneCountInString(c) > widths[i] {
+				widths[i] = utf8.RuneCountInString(c)
+			}
+		}
+	}
+	measure(d.Columns)
+	for _, r := range d.Rows {
+		measure(r)
+	}
+
+	rule := "+"
+	for _, w := range widths {
+		rule += strings.Repeat("-", w+2) + "+"
+	}
+	line := func(cells []string) {
+		b.WriteString("|")
+		for i, w := range widths {
+			var c string
+			if i < len(cells) {
+				c = cells[i]
+			}
+			b.WriteString(" " + c + strings.Repeat(" ", w-utf8.RuneCountInString(c)) + " |")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(rule + "\n")
+	line(d.Columns)
+	b.WriteString(rule + "\n")
+	for _, r := range d.Rows {
+		line(r)
+	}
+	b.WriteString(rule + "\n")
+	return b.String()
+}
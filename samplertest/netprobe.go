@@ -0,0 +1,534 @@
+package samplertest // import "wonderland.org/geneos/samplertest"
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wonderland.org/geneos/plugins"
+	"wonderland.org/geneos/samplers"
+)
+
+// URL is the XML-RPC endpoint of connections made by Netprobe.Connection().
+// Nothing listens on it, requests are handled in memory.
+const URL = "http://samplertest/xmlrpc"
+
+/*
+Netprobe is an in-memory stand in for the XML-RPC API of a Netprobe. It
+keeps the dataviews, headlines and stream messages that samplers publish
+so tests can check them. Connections returned by Connection() send their
+requests straight to it, as an http.RoundTripper, without a network.
+
+Row update times, used by getRowNamesOlderThan, come from the Netprobe's
+FakeClock. It is more forgiving than a real Netprobe in one way: a table
+update may change the columns.
+*/
+type Netprobe struct {
+	mu         sync.Mutex
+	clock      *samplers.FakeClock
+	parameters map[string]string
+	samplers   map[string]*sampler // by entity.sampler
+	calls      []string
+}
+
+// sampler is the state of one entity.sampler
+type sampler struct {
+	views   map[string]*view // by group-view
+	streams map[string][]string
+}
+
+// view is the state of one dataview
+type view struct {
+	name, group string
+	columns     []string // the first is the row name column
+	rows        []string
+	cells       map[string][]string // by row name, without the row name
+	updated     map[string]time.Time
+	headlines   []string
+	values      map[string]string
+}
+
+// NewNetprobe returns an empty Netprobe with a new FakeClock
+func NewNetprobe() *Netprobe {
+	return &Netprobe{
+		clock:      samplers.NewFakeClock(time.Time{}),
+		parameters: make(map[string]string),
+		samplers:   make(map[string]*sampler),
+	}
+}
+
+// Clock returns the FakeClock used for row update times
+func (n *Netprobe) Clock() *samplers.FakeClock {
+	return n.clock
+}
+
+// Connection returns a connection to the sampler entity.sampler, which
+// is created if needed
+func (n *Netprobe) Connection(entity string, samplername string) (c plugins.Connection, err error) {
+	if c, err = plugins.Sampler(URL, entity, samplername); err != nil {
+		return
+	}
+	c.Transport = n
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sampler(entity + "." + samplername)
+	return
+}
+
+// sampler returns the named sampler, creating it if needed. The caller
+// holds n.mu
+func (n *Netprobe) sampler(name string) *sampler {
+	s, ok := n.samplers[name]
+	if !ok {
+		s = &sampler{views: make(map[string]*view), streams: make(map[string][]string)}
+		n.samplers[name] = s
+	}
+	return s
+}
+
+// SetParameter sets the value of a sampler parameter, as read by
+// Parameter() and the typed getters, for all samplers
+func (n *Netprobe) SetParameter(name string, value string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.parameters[name] = value
+}
+
+// Calls returns the XML-RPC calls made so far, one per line in the form
+// method(args), and clears the list
+func (n *Netprobe) Calls() (calls []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	calls, n.calls = n.calls, nil
+	return
+}
+
+// Dataview returns a copy of the named dataview of entity.sampler, or
+// false if it does not exist
+func (n *Netprobe) Dataview(entity, samplername, name, group string) (d *Dataview, ok bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	s, ok := n.samplers[entity+"."+samplername]
+	if !ok {
+		return
+	}
+	v, ok := s.views[group+"-"+name]
+	if !ok {
+		return
+	}
+	return v.snapshot(), true
+}
+
+// Dataviews returns the names of the dataviews of entity.sampler, as
+// group-name, sorted
+func (n *Netprobe) Dataviews(entity, samplername string) (names []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if s, ok := n.samplers[entity+"."+samplername]; ok {
+		for name := range s.views {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// Stream returns the messages written to a stream of entity.sampler,
+// oldest first
+func (n *Netprobe) Stream(entity, samplername, stream string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if s, ok := n.samplers[entity+"."+samplername]; ok {
+		return append([]string{}, s.streams[stream]...)
+	}
+	return nil
+}
+
+// RoundTrip handles one XML-RPC request
+func (n *Netprobe) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	var call methodCall
+	if err = xml.Unmarshal(b, &call); err != nil {
+		out = fault(err)
+	} else {
+		args := make([]string, len(call.Params))
+		for i, p := range call.Params {
+			args[i] = p.text()
+		}
+		n.mu.Lock()
+		n.calls = append(n.calls, call.Method+"("+strings.Join(args, ", ")+")")
+		result, err := n.dispatch(call.Method, call.Params)
+		n.mu.Unlock()
+		if err != nil {
+			out = fault(err)
+		} else {
+			out = response(result)
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/xml"}},
+		Body:          io.NopCloser(bytes.NewReader(out)),
+		ContentLength: int64(len(out)),
+		Request:       req,
+	}, nil
+}
+
+// dispatch runs a method. The caller holds n.mu
+func (n *Netprobe) dispatch(method string, params []value) (result interface{}, err error) {
+	arg := func(i int) string {
+		if i < len(params) {
+			return params[i].string()
+		}
+		return ""
+	}
+
+	switch method {
+	case "_netprobe.gatewayConnected":
+		return true, nil
+	case "_netprobe.managedEntityExists":
+		for name := range n.samplers {
+			if strings.HasPrefix(name, arg(0)+".") {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "_netprobe.samplerExists":
+		_, ok := n.samplers[arg(0)]
+		return ok, nil
+	}
+
+	// the longest matching entity.sampler, as names may contain dots
+	var name string
+	for k := range n.samplers {
+		if strings.HasPrefix(method, k+".") && len(k) > len(name) {
+			name = k
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%s: sampler does not exist", method)
+	}
+	s := n.samplers[name]
+	rest := method[len(name)+1:]
+	i := strings.LastIndexByte(rest, '.')
+	if i == -1 {
+		return n.samplerMethod(s, rest, arg)
+	}
+	target, op := rest[:i], rest[i+1:]
+
+	switch op {
+	case "addMessage":
+		s.streams[target] = append(s.streams[target], arg(0))
+		return "OK", nil
+	case "signOn", "signOff", "heartBeat":
+		return "OK", nil
+	}
+	v, ok := s.views[target]
+	if !ok {
+		return nil, fmt.Errorf("%s: dataview %q does not exist", method, target)
+	}
+	return n.viewMethod(v, op, params, arg)
+}
+
+// samplerMethod runs a method on the sampler. The caller holds n.mu
+func (n *Netprobe) samplerMethod(s *sampler, op string, arg func(int) string) (result interface{}, err error) {
+	switch op {
+	case "createView":
+		name := arg(1) + "-" + arg(0)
+		if _, ok := s.views[name]; ok {
+			return nil, fmt.Errorf("createView: dataview %q already exists", name)
+		}
+		s.views[name] = &view{
+			name:    arg(0),
+			group:   arg(1),
+			cells:   make(map[string][]string),
+			updated: make(map[string]time.Time),
+			values:  make(map[string]string),
+		}
+	case "viewExists":
+		_, ok := s.views[arg(0)]
+		return ok, nil
+	case "removeView":
+		name := arg(1) + "-" + arg(0)
+		if _, ok := s.views[name]; !ok {
+			return nil, fmt.Errorf("removeView: dataview %q does not exist", name)
+		}
+		delete(s.views, name)
+	case "getParameter":
+		return n.parameters[arg(0)], nil
+	case "signOn", "signOff", "heartBeat":
+	default:
+		return nil, fmt.Errorf("%s: unknown method", op)
+	}
+	return "OK", nil
+}
+
+// viewMethod runs a method on a dataview. The caller holds n.mu
+func (n *Netprobe) viewMethod(v *view, op string, params []value, arg func(int) string) (result interface{}, err error) {
+	now := n.clock.Now()
+	switch op {
+	case "updateEntireTable":
+		if len(params) == 0 || len(params[0].Array) == 0 {
+			return nil, fmt.Errorf("%s: no column names", op)
+		}
+		table := params[0].Array
+		v.columns = table[0].strings()
+		v.rows = nil
+		v.cells = make(map[string][]string, len(table)-1)
+		for _, r := range table[1:] {
+			row := r.strings()
+			if len(row) == 0 {
+				continue
+			}
+			if _, ok := v.cells[row[0]]; !ok {
+				v.rows = append(v.rows, row[0])
+			}
+			v.cells[row[0]] = v.pad(row[1:])
+			v.updated[row[0]] = now
+		}
+	case "addTableColumn":
+		if v.column(arg(0)) != -1 {
+			return nil, fmt.Errorf("%s: column %q already exists", op, arg(0))
+		}
+		v.columns = append(v.columns, arg(0))
+	case "addTableRow":
+		if _, ok := v.cells[arg(0)]; ok {
+			return nil, fmt.Errorf("%s: row %q already exists", op, arg(0))
+		}
+		v.rows = append(v.rows, arg(0))
+		v.cells[arg(0)] = v.pad(nil)
+		v.updated[arg(0)] = now
+	case "updateTableRow":
+		if _, ok := v.cells[arg(0)]; !ok {
+			return nil, fmt.Errorf("%s: row %q does not exist", op, arg(0))
+		}
+		var cells []string
+		if len(params) > 1 {
+			cells = params[1].strings()
+		}
+		if len(v.columns) > 0 && len(cells) > len(v.columns)-1 {
+			return nil, fmt.Errorf("%s: %d values for %d columns", op, len(cells), len(v.columns)-1)
+		}
+		v.cells[arg(0)] = v.pad(cells)
+		v.updated[arg(0)] = now
+	case "updateTableCell", "updateVariable":
+		row, column, ok := v.cell(arg(0))
+		if !ok {
+			if op == "updateVariable" {
+				if _, ok := v.values[arg(0)]; ok {
+					v.values[arg(0)] = arg(1)
+					break
+				}
+			}
+			return nil, fmt.Errorf("%s: cell %q does not exist", op, arg(0))
+		}
+		cells := v.pad(v.cells[row])
+		cells[column-1] = arg(1)
+		v.cells[row] = cells
+		v.updated[row] = now
+	case "removeTableRow":
+		if _, ok := v.cells[arg(0)]; !ok {
+			return nil, fmt.Errorf("%s: row %q does not exist", op, arg(0))
+		}
+		delete(v.cells, arg(0))
+		delete(v.updated, arg(0))
+		v.rows = remove(v.rows, arg(0))
+	case "addHeadline":
+		if _, ok := v.values[arg(0)]; ok {
+			return nil, fmt.Errorf("%s: headline %q already exists", op, arg(0))
+		}
+		v.headlines = append(v.headlines, arg(0))
+		v.values[arg(0)] = ""
+	case "updateHeadline":
+		if _, ok := v.values[arg(0)]; !ok {
+			return nil, fmt.Errorf("%s: headline %q does not exist", op, arg(0))
+		}
+		v.values[arg(0)] = arg(1)
+	case "removeHeadline":
+		if _, ok := v.values[arg(0)]; !ok {
+			return nil, fmt.Errorf("%s: headline %q does not exist", op, arg(0))
+		}
+		delete(v.values, arg(0))
+		v.headlines = remove(v.headlines, arg(0))
+	case "columnExists":
+		return v.column(arg(0)) != -1, nil
+	case "rowExists":
+		_, ok := v.cells[arg(0)]
+		return ok, nil
+	case "headlineExists":
+		_, ok := v.values[arg(0)]
+		return ok, nil
+	case "getColumnCount":
+		return len(v.columns), nil
+	case "getRowCount":
+		return len(v.rows), nil
+	case "getHeadlineCount":
+		return len(v.headlines), nil
+	case "getColumnNames":
+		return append([]string{}, v.columns...), nil
+	case "getRowNames":
+		return append([]string{}, v.rows...), nil
+	case "getHeadlineNames":
+		return append([]string{}, v.headlines...), nil
+	case "getRowNamesOlderThan":
+		t, err := strconv.ParseInt(arg(0), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		names := []string{}
+		for _, row := range v.rows {
+			if v.updated[row].Unix() < t {
+				names = append(names, row)
+			}
+		}
+		return names, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown method", op)
+	}
+	return "OK", nil
+}
+
+// column returns the index of a column, or -1
+func (v *view) column(name string) int {
+	for i, c := range v.columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// cell splits a ROW.COLUMN cell name, trying each row as names may
+// contain dots
+func (v *view) cell(name string) (row string, column int, ok bool) {
+	for _, r := range v.rows {
+		if !strings.HasPrefix(name, r+".") {
+			continue
+		}
+		if column = v.column(name[len(r)+1:]); column > 0 {
+			return r, column, true
+		}
+	}
+	return
+}
+
+// pad returns cells with one value for each column after the row name
+func (v *view) pad(cells []string) []string {
+	n := len(v.columns) - 1
+	if n < len(cells) {
+		n = len(cells)
+	}
+	padded := make([]string, n)
+	copy(padded, cells)
+	return padded
+}
+
+func remove(list []string, name string) []string {
+	for i, s := range list {
+		if s == name {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// methodCall is an XML-RPC request
+type methodCall struct {
+	Method string  `xml:"methodName"`
+	Params []value `xml:"params>param>value"`
+}
+
+// value is an XML-RPC value. A value without a type is a string.
+type value struct {
+	String *string `xml:"string"`
+	Int    *int    `xml:"int"`
+	Array  []value `xml:"array>data>value"`
+	Text   string  `xml:",chardata"`
+}
+
+func (v value) string() string {
+	switch {
+	case v.String != nil:
+		return *v.String
+	case v.Int != nil:
+		return strconv.Itoa(*v.Int)
+	default:
+		return strings.TrimSpace(v.Text)
+	}
+}
+
+func (v value) strings() (s []string) {
+	for _, e := range v.Array {
+		s = append(s, e.string())
+	}
+	return
+}
+
+// text is used in the Calls() list
+func (v value) text() string {
+	if v.Array != nil {
+		parts := make([]string, len(v.Array))
+		for i, e := range v.Array {
+			parts[i] = e.text()
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return strconv.Quote(v.string())
+}
+
+// response encodes the result of a successful call
+func response(result interface{}) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?><methodResponse><params><param><value>`)
+	switch r := result.(type) {
+	case bool:
+		if r {
+			b.WriteString("<boolean>1</boolean>")
+		} else {
+			b.WriteString("<boolean>0</boolean>")
+		}
+	case int:
+		fmt.Fprintf(&b, "<int>%d</int>", r)
+	case string:
+		b.WriteString("<string>")
+		xml.EscapeText(&b, []byte(r))
+		b.WriteString("</string>")
+	case []string:
+		b.WriteString("<array><data>")
+		for _, s := range r {
+			b.WriteString("<value><string>")
+			xml.EscapeText(&b, []byte(s))
+			b.WriteString("</string></value>")
+		}
+		b.WriteString("</data></array>")
+	}
+	b.WriteString("</value></param></params></methodResponse>")
+	return b.Bytes()
+}
+
+// fault encodes an error
+func fault(err error) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?><methodResponse><fault><value><struct>`)
+	b.WriteString("<member><name>faultCode</name><value><int>1</int></value></member>")
+	b.WriteString("<member><name>faultString</name><value><string>")
+	xml.EscapeText(&b, []byte(err.Error()))
+	b.WriteString("</string></value></member></struct></value></fault></methodResponse>")
+	return b.Bytes()
+}
@@ -0,0 +1,134 @@
+/*
+Package samplertest runs plugins against an in-memory Netprobe so that
+InitSampler() and DoSample() can be tested without Geneos.
+
+A plugin is built with its normal constructor, given a FakeClock and
+initialised by Start(). Run() then calls DoSample() a number of times,
+moving the clock on by the sample interval before each, and the
+dataviews, headlines and stream messages published can be checked with
+the assertion functions or against a golden file:
+
+	func TestGeneric(t *testing.T) {
+		n := samplertest.NewNetprobe()
+		n.SetParameter("EXAMPLE", "hello")
+		h, err := samplertest.Start(n, generic.New, "example", "SYSTEM")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		if err = h.Run(2); err != nil {
+			t.Fatal(err)
+		}
+		d := h.Dataview()
+		samplertest.AssertHeadline(t, d, "example", "hello")
+		samplertest.AssertRows(t, d, "row4", "row2", "row3", "row1")
+		samplertest.Golden(t, "testdata/generic.golden", d.String())
+	}
+
+Run the tests with SAMPLERTEST_UPDATE=1 set to write the golden files.
+*/
+package samplertest // import "wonderland.org/geneos/samplertest"
+
+import (
+	"fmt"
+	"time"
+
+	"wonderland.org/geneos/plugins"
+	"wonderland.org/geneos/samplers"
+)
+
+// the managed entity and sampler that Start() connects plugins to
+const (
+	Entity  = "samplertest"
+	Sampler = "samplertest"
+)
+
+// Harness is a plugin connected to a Netprobe and ready to sample
+type Harness[P plugins.Plugins] struct {
+	Plugin   P
+	Netprobe *Netprobe
+	Clock    *samplers.FakeClock
+
+	name, group string
+	samples     int
+}
+
+// Start builds a plugin with constructor, as the program using it would,
+// sets its clock to the Netprobe's FakeClock and calls InitSampler(). The
+// plugin is not started, use Run() to take samples.
+func Start[P plugins.Plugins](n *Netprobe, constructor func(plugins.Connection, string, string) (P, error),
+	name string, group string) (h *Harness[P], err error) {
+	conn, err := n.Connection(Entity, Sampler)
+	if err != nil {
+		return
+	}
+	p, err := constructor(conn, name, group)
+	if err != nil {
+		return nil, fmt.Errorf("samplertest: new %s: %w", name, err)
+	}
+	h = &Harness[P]{Plugin: p, Netprobe: n, Clock: n.clock, name: name, group: group}
+	if c, ok := interface{}(p).(interface{ SetClock(samplers.Clock) }); ok {
+		c.SetClock(n.clock)
+	}
+	if i, ok := interface{}(p).(interface{ InitSampler() error }); ok {
+		if err = i.InitSampler(); err != nil {
+			return nil, fmt.Errorf("samplertest: InitSampler(): %w", err)
+		}
+	}
+	return
+}
+
+// Run takes count samples, each time moving the clock on by the sample
+// interval and then calling DoSample(), and stops at the first error. A
+// panic is returned as a *samplers.PanicError.
+func (h *Harness[P]) Run(count int) (err error) {
+	s, ok := interface{}(h.Plugin).(interface{ Sample() error })
+	if !ok {
+		return fmt.Errorf("samplertest: %T does not embed samplers.Samplers", h.Plugin)
+	}
+	for i := 0; i < count; i++ {
+		h.Clock.Advance(h.interval())
+		h.samples++
+		if err = s.Sample(); err != nil {
+			return fmt.Errorf("samplertest: sample %d: %w", h.samples, err)
+		}
+	}
+	return
+}
+
+// interval is the sample interval, with the same default and minimum of
+// one second as a running sampler
+func (h *Harness[P]) interval() time.Duration {
+	if i := h.Plugin.Interval(); i >= time.Second {
+		return i
+	}
+	return time.Second
+}
+
+// Samples returns the number of samples taken by Run()
+func (h *Harness[P]) Samples() int {
+	return h.samples
+}
+
+// Dataview returns a copy of the plugin's default dataview, or nil if it
+// has been removed
+func (h *Harness[P]) Dataview() *Dataview {
+	return h.View(h.name, h.group)
+}
+
+// View returns a copy of another dataview of the plugin, such as those
+// added with AddView(), or nil if it does not exist
+func (h *Harness[P]) View(name string, group string) *Dataview {
+	d, _ := h.Netprobe.Dataview(Entity, Sampler, name, group)
+	return d
+}
+
+// Stream returns the messages the plugin has written to a stream
+func (h *Harness[P]) Stream(name string) []string {
+	return h.Netprobe.Stream(Entity, Sampler, name)
+}
+
+// Close closes the plugin, removing its dataviews
+func (h *Harness[P]) Close() error {
+	return h.Plugin.Close()
+}
@@ -0,0 +1,140 @@
+package samplertest_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/plugins"
+	"wonderland.org/geneos/samplers"
+	"wonderland.org/geneos/samplertest"
+	"wonderland.org/geneos/streams"
+)
+
+type exampleRow struct {
+	Name  string    `column:"name,sort="`
+	Value string    `column:"value"`
+	Seen  time.Time `column:"seen,time=age"`
+}
+
+// example is a plugin like those in the example directory
+type example struct {
+	samplers.Samplers
+	samples int
+	start   time.Time
+	events  streams.Stream
+}
+
+func newExample(c plugins.Connection, name string, group string) (*example, error) {
+	e := &example{}
+	e.Plugins = e
+	return e, e.New(c, name, group)
+}
+
+func (e *example) InitSampler() (err error) {
+	value, err := e.Parameter("EXAMPLE")
+	if err != nil {
+		return
+	}
+	c, names, sortcol, err := e.ColumnInfo(exampleRow{})
+	if err != nil {
+		return
+	}
+	e.SetColumns(c)
+	e.SetColumnNames(names)
+	e.SetSortColumn(sortcol)
+	e.start = e.Clock().Now()
+	if e.events, err = streams.Sampler(samplertest.URL, samplertest.Entity, samplertest.Sampler); err != nil {
+		return
+	}
+	e.events.Transport = e.Transport
+	e.events.SetStreamName("events")
+	return e.Headline("example", value)
+}
+
+func (e *example) DoSample() error {
+	e.samples++
+	rows := []exampleRow{{"b", "two & <2>", e.start}, {"a", "one", e.start}}
+	if e.samples == 1 {
+		rows = append(rows, exampleRow{"c", "first", e.start})
+	}
+	if _, err := e.events.WriteString("sample"); err != nil {
+		return err
+	}
+	return e.UpdateTableFromSlice(rows)
+}
+
+func TestHarness(t *testing.T) {
+	n := samplertest.NewNetprobe()
+	n.SetParameter("EXAMPLE", "hello & <bye>")
+	h, err := samplertest.Start(n, newExample, "example", "SYSTEM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Plugin.SetInterval(5 * time.Second)
+	if err = h.Run(1); err != nil {
+		t.Fatal(err)
+	}
+	d := h.Dataview()
+	samplertest.AssertHeadline(t, d, "example", "hello & <bye>")
+	samplertest.AssertRows(t, d, "b", "a", "c")
+	samplertest.AssertCell(t, d, "b", "value", "two & <2>")
+	samplertest.AssertCell(t, d, "c", "seen", "5s")
+
+	if err = h.Run(2); err != nil {
+		t.Fatal(err)
+	}
+	if h.Samples() != 3 {
+		t.Errorf("Samples() = %d, want 3", h.Samples())
+	}
+	d = h.Dataview()
+	samplertest.AssertRows(t, d, "b", "a")
+	if got, want := d.Column("seen"), []string{"15s", "15s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Column(seen) = %q, want %q", got, want)
+	}
+	if got, want := h.Stream("events"), []string{"sample", "sample", "sample"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Stream(events) = %q, want %q", got, want)
+	}
+	samplertest.Golden(t, "testdata/harness.golden", d.String())
+
+	if err = h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if names := n.Dataviews(samplertest.Entity, samplertest.Sampler); len(names) != 0 {
+		t.Errorf("dataviews left after Close(): %q", names)
+	}
+}
+
+func TestNetprobeCalls(t *testing.T) {
+	n := samplertest.NewNetprobe()
+	c, err := n.Connection(samplertest.Entity, samplertest.Sampler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.NewDataview("view", "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.UpdateTable([]string{"name", "a", "b"}, []string{"r1", "1", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.UpdateCell("r1", "b", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.UpdateCell("nosuch", "b", "3"); err == nil {
+		t.Error("UpdateCell() of a missing row: no error")
+	}
+	if _, err = c.Parameter("UNSET"); err != nil {
+		t.Errorf("Parameter() of an unset parameter: %v", err)
+	}
+	view, ok := n.Dataview(samplertest.Entity, samplertest.Sampler, "view", "group")
+	if !ok {
+		t.Fatal("dataview not found")
+	}
+	if got, want := view.Row("r1"), []string{"r1", "1", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Row(r1) = %q, want %q", got, want)
+	}
+	if calls := n.Calls(); len(calls) == 0 || n.Calls() != nil {
+		t.Errorf("Calls() = %q, then not cleared", calls)
+	}
+}
@@ -0,0 +1,277 @@
+/*
+Package shutdown coordinates a clean exit of a plugin process so that
+dataviews and heartbeats are not left behind in Geneos.
+
+Samplers register themselves when they are started, and sampler and
+stream heartbeats when they sign on with plugins.Connection or
+streams.Stream. A program only needs to call
+Notify() early in main() and, if it has nothing else to wait for, end
+with Wait() rather than closing things itself:
+
+	func main() {
+		shutdown.Notify()
+		...
+		os.Exit(shutdown.Wait())
+	}
+
+On SIGINT or SIGTERM every registered sampler is told to stop and the
+calls in progress are given StopTimeout to return. Then, in parallel,
+the dataviews are removed and heartbeats signed off, within
+TeardownTimeout, and the process exits with ExitOK, ExitError or
+ExitTimeout. A second signal exits at once with ExitTimeout.
+*/
+package shutdown // import "wonderland.org/geneos/shutdown"
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"wonderland.org/geneos"
+)
+
+var (
+	Logger      = geneos.Logger
+	DebugLogger = geneos.DebugLogger
+	ErrorLogger = geneos.ErrorLogger
+)
+
+// exit statuses returned by Shutdown() and used by Notify()
+const (
+	ExitOK      = 0 // everything stopped and was removed
+	ExitError   = 1 // one or more teardowns failed
+	ExitTimeout = 2 // something didn't finish in time
+)
+
+// defaults for new Coordinators
+const (
+	DefaultStopTimeout     = 10 * time.Second
+	DefaultTeardownTimeout = 10 * time.Second
+)
+
+// Hook is what a registered component does at shutdown. Either func
+// can be nil.
+type Hook struct {
+	// Name is used in log messages
+	Name string
+	// Stop stops new work starting and waits for work in progress
+	Stop func()
+	// Teardown removes anything published to Geneos, such as dataviews,
+	// and signs off heartbeats. It is called after every Stop has
+	// returned or timed out.
+	Teardown func() error
+}
+
+// Coordinator runs the registered hooks at shutdown
+type Coordinator struct {
+	StopTimeout     time.Duration
+	TeardownTimeout time.Duration
+
+	mu     sync.Mutex
+	hooks  map[interface{}]Hook
+	order  []interface{} // keys in the order registered
+	done   chan struct{} // closed when the first Shutdown() returns
+	status int           // of the first Shutdown()
+}
+
+// Default is the Coordinator used by the package level functions and
+// that samplers and streams register with
+var Default = NewCoordinator()
+
+// NewCoordinator returns a Coordinator with the default timeouts
+func NewCoordinator() *Coordinator {
+	return &Coordinator{
+		StopTimeout:     DefaultStopTimeout,
+		TeardownTimeout: DefaultTeardownTimeout,
+		hooks:           make(map[interface{}]Hook),
+		done:            make(chan struct{}),
+	}
+}
+
+// Register adds or replaces the hook for key, which must be comparable,
+// e.g. a pointer to the component
+func (c *Coordinator) Register(key interface{}, hook Hook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.hooks[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.hooks[key] = hook
+}
+
+// Unregister removes the hook for key, e.g. when a component is closed
+// normally
+func (c *Coordinator) Unregister(key interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.hooks[key]; !ok {
+		return
+	}
+	delete(c.hooks, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Hooks returns the registered hooks in the order they were registered
+func (c *Coordinator) Hooks() (hooks []Hook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range c.order {
+		hooks = append(hooks, c.hooks[k])
+	}
+	return
+}
+
+// Shutdown stops and then tears down everything registered, each phase
+// in parallel and within its timeout, and returns the exit status. The
+// hooks are run on a copy of the list so they can Unregister themselves.
+func (c *Coordinator) Shutdown() (status int) {
+	hooks := c.Hooks()
+	Logger.Printf("shutting down %d components", len(hooks))
+
+	status = ExitOK
+	if !run(hooks, c.StopTimeout, "stop", func(h Hook) error {
+		if h.Stop != nil {
+			h.Stop()
+		}
+		return nil
+	}) {
+		status = ExitTimeout
+	}
+
+	var mu sync.Mutex
+	failed := false
+	if !run(hooks, c.TeardownTimeout, "teardown", func(h Hook) (err error) {
+		if h.Teardown != nil {
+			if err = h.Teardown(); err != nil {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}
+		return
+	}) {
+		status = ExitTimeout
+	}
+	mu.Lock()
+	if failed && status == ExitOK {
+		status = ExitError
+	}
+	mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+	default:
+		c.status = status
+		close(c.done)
+	}
+	return
+}
+
+// Wait blocks until Shutdown() has returned, usually after a signal
+// handled by Notify(), and returns its exit status. A program that has
+// nothing else to wait for can end main() with:
+//
+//	os.Exit(shutdown.Wait())
+func (c *Coordinator) Wait() int {
+	<-c.done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// run calls f for each hook in parallel and waits up to timeout for them
+// all to return. It returns false if any did not, after logging them.
+func run(hooks []Hook, timeout time.Duration, phase string, f func(Hook) error) bool {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	pending := make(map[int]string, len(hooks))
+	for i, h := range hooks {
+		pending[i] = h.Name
+	}
+	for i, h := range hooks {
+		wg.Add(1)
+		go func(i int, h Hook) {
+			defer wg.Done()
+			if err := f(h); err != nil {
+				ErrorLogger.Printf("%s %s: %v", phase, h.Name, err)
+			}
+			mu.Lock()
+			delete(pending, i)
+			mu.Unlock()
+		}(i, h)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		mu.Lock()
+		defer mu.Unlock()
+		for _, name := range pending {
+			ErrorLogger.Printf("%s %s: timed out after %v", phase, name, timeout)
+		}
+		return false
+	}
+}
+
+// Notify handles SIGINT and SIGTERM, or signals if given, by calling
+// Shutdown() and exiting with its status. A second signal while shutting
+// down exits straight away with ExitTimeout.
+func (c *Coordinator) Notify(signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, signals...)
+	go func() {
+		sig := <-ch
+		Logger.Printf("received %v", sig)
+		go func() {
+			sig := <-ch
+			ErrorLogger.Printf("received %v while shutting down, exiting now", sig)
+			os.Exit(ExitTimeout)
+		}()
+		os.Exit(c.Shutdown())
+	}()
+}
+
+// Register adds or replaces a hook on the Default Coordinator
+func Register(key interface{}, hook Hook) {
+	Default.Register(key, hook)
+}
+
+// Unregister removes a hook from the Default Coordinator
+func Unregister(key interface{}) {
+	Default.Unregister(key)
+}
+
+// Shutdown runs the Default Coordinator's shutdown and returns the exit
+// status
+func Shutdown() int {
+	return Default.Shutdown()
+}
+
+// Notify handles signals with the Default Coordinator
+func Notify(signals ...os.Signal) {
+	Default.Notify(signals...)
+}
+
+// Wait waits for the Default Coordinator's shutdown and returns the exit
+// status
+func Wait() int {
+	return Default.Wait()
+}
@@ -0,0 +1,72 @@
+package shutdown
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	tests := []struct {
+		name  string
+		hooks []Hook
+		want  int
+	}{
+		{"none", nil, ExitOK},
+		{"ok", []Hook{{Name: "a", Stop: func() {}, Teardown: func() error { return nil }}, {Name: "b"}}, ExitOK},
+		{"teardown fails", []Hook{{Name: "a", Teardown: func() error { return errors.New("failed") }}}, ExitError},
+		{"stop hangs", []Hook{{Name: "a", Stop: func() { <-block }}}, ExitTimeout},
+	}
+	for _, tt := range tests {
+		c := NewCoordinator()
+		c.StopTimeout, c.TeardownTimeout = 50*time.Millisecond, 50*time.Millisecond
+		var mu sync.Mutex
+		var order []string
+		for i, h := range tt.hooks {
+			h := h
+			teardown := h.Teardown
+			h.Teardown = func() error {
+				mu.Lock()
+				order = append(order, h.Name)
+				mu.Unlock()
+				if teardown != nil {
+					return teardown()
+				}
+				return nil
+			}
+			c.Register(i, h)
+		}
+		waited := make(chan int)
+		go func() { waited <- c.Wait() }()
+		if got := c.Shutdown(); got != tt.want {
+			t.Errorf("%s: Shutdown() = %d, want %d", tt.name, got, tt.want)
+		}
+		if got := <-waited; got != tt.want {
+			t.Errorf("%s: Wait() = %d, want %d", tt.name, got, tt.want)
+		}
+		if len(order) != len(tt.hooks) {
+			t.Errorf("%s: %d teardowns, want %d", tt.name, len(order), len(tt.hooks))
+		}
+		// a second shutdown doesn't change what Wait() returns
+		c.Shutdown()
+		if got := c.Wait(); got != tt.want {
+			t.Errorf("%s: Wait() after a second Shutdown() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	c := NewCoordinator()
+	c.Register("a", Hook{Name: "a"})
+	c.Register("b", Hook{Name: "b"})
+	c.Register("a", Hook{Name: "a2"})
+	c.Unregister("b")
+	c.Unregister("nosuch")
+	hooks := c.Hooks()
+	if len(hooks) != 1 || hooks[0].Name != "a2" {
+		t.Errorf("Hooks() = %+v", hooks)
+	}
+}
@@ -3,8 +3,10 @@ package streams // import "wonderland.org/geneos/streams"
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"wonderland.org/geneos"
+	"wonderland.org/geneos/shutdown"
 	"wonderland.org/geneos/xmlrpc"
 )
 
@@ -61,3 +63,42 @@ func (s Stream) WriteString(data string) (n int, err error) {
 	n = len(data)
 	return
 }
+
+// signOnKey identifies a sign on registered for shutdown
+type signOnKey struct {
+	url, entity, sampler, stream string
+}
+
+// SignOn signs on to the stream, requiring a Heartbeat() within the
+// interval given, and registers with the shutdown package so that it is
+// signed off if the process is stopped
+func (s Stream) SignOn(heartbeat time.Duration) (err error) {
+	if s.name == "" {
+		return fmt.Errorf("streamname not set")
+	}
+	if err = s.SignOnStream(s.name, heartbeat); err != nil {
+		return
+	}
+	shutdown.Register(signOnKey{s.URL(), s.EntityName(), s.SamplerName(), s.name}, shutdown.Hook{
+		Name:     "sign on " + s.ToString() + "." + s.name,
+		Teardown: func() error { return s.SignOffStream(s.name) },
+	})
+	return
+}
+
+// SignOff cancels the heartbeat requirement set by SignOn()
+func (s Stream) SignOff() error {
+	if s.name == "" {
+		return fmt.Errorf("streamname not set")
+	}
+	shutdown.Unregister(signOnKey{s.URL(), s.EntityName(), s.SamplerName(), s.name})
+	return s.SignOffStream(s.name)
+}
+
+// Heartbeat resets the watchdog timer started by SignOn()
+func (s Stream) Heartbeat() error {
+	if s.name == "" {
+		return fmt.Errorf("streamname not set")
+	}
+	return s.HeartbeatStream(s.name)
+}
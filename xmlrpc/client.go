@@ -60,6 +60,12 @@ func (c *Client) AllowUnverifiedCertificates() {
 	c.Client = http.Client{Transport: tr}
 }
 
+// SetTLSConfig sets the TLS settings used for https connections, e.g.
+// to trust a private CA or present a client certificate
+func (c *Client) SetTLSConfig(config *tls.Config) {
+	c.Client = http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
 /*
 Sampler creates and returns a new Sampler struct from the lower level.
 
@@ -229,6 +229,13 @@ func (d Dataview) Headline(name string, args ...string) (err error) {
 	return
 }
 
+// UpdateHeadline sets the value of a headline that is known to exist,
+// skipping the existence checks made by Headline(). The Netprobe returns
+// an error if it does not.
+func (d Dataview) UpdateHeadline(name string, value string) error {
+	return d.updateHeadline(d.EntityName(), d.SamplerName(), d.dataviewName, name, value)
+}
+
 func (d Dataview) CountHeadlines() (int, error) {
 	if !d.IsValid() {
 		err := err_dataview_exists
@@ -167,7 +167,7 @@ func marshal(c methodCall) ([]byte, error) {
 		for _, a := range c.Values {
 			data += "<param><value>"
 			if a.String != "" {
-				data += "<string>" + a.String + "</string>"
+				data += "<string>" + escape(a.String) + "</string>"
 			} else if a.Int != 0 {
 				data += "<int>" + strconv.Itoa(a.Int) + "</int>"
 			} else if a.Array != nil {
@@ -176,14 +176,14 @@ func marshal(c methodCall) ([]byte, error) {
 				case []string:
 					as := a.Array.([]string)
 					for _, s := range as {
-						data += "<value><string>" + s + "</string></value>"
+						data += "<value><string>" + escape(s) + "</string></value>"
 					}
 				case [][]string:
 					ass := a.Array.([][]string)
 					for _, s1 := range ass {
 						data += "<value><array><data>"
 						for _, s2 := range s1 {
-							data += "<value><string>" + s2 + "</string></value>"
+							data += "<value><string>" + escape(s2) + "</string></value>"
 
 						}
 						data += "</data></array></value>"
@@ -202,3 +202,10 @@ func marshal(c methodCall) ([]byte, error) {
 	data += "</methodCall>"
 	return []byte(data), err
 }
+
+// escape replaces the characters that are special in XML text
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
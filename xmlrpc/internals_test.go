@@ -0,0 +1,48 @@
+package xmlrpc
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestMarshalEscapesStrings(t *testing.T) {
+	tests := []string{
+		`a < b`,
+		`fish & chips`,
+		`say "hello"`,
+		`<tag attr="x">&amp;</tag>`,
+	}
+	for _, s := range tests {
+		call := methodCall{Name: "test", Values: []valueArray{
+			{String: s},
+			{Array: []string{s}},
+			{Array: [][]string{{s, s}}},
+		}}
+		out, err := marshal(call)
+		if err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		var got struct {
+			Params []struct {
+				String string   `xml:"value>string"`
+				Array  []string `xml:"value>array>data>value>string"`
+				Nested []string `xml:"value>array>data>value>array>data>value>string"`
+			} `xml:"params>param"`
+		}
+		if err = xml.Unmarshal(out, &got); err != nil {
+			t.Fatalf("%q: %v in %s", s, err, out)
+		}
+		if len(got.Params) != 3 {
+			t.Fatalf("%q: got %d params, want 3", s, len(got.Params))
+		}
+		if got.Params[0].String != s {
+			t.Errorf("string: got %q, want %q", got.Params[0].String, s)
+		}
+		if len(got.Params[1].Array) != 1 || got.Params[1].Array[0] != s {
+			t.Errorf("array: got %q, want [%q]", got.Params[1].Array, s)
+		}
+		if len(got.Params[2].Nested) != 2 || got.Params[2].Nested[1] != s {
+			t.Errorf("nested array: got %q, want [%q %q]", got.Params[2].Nested, s, s)
+		}
+	}
+}
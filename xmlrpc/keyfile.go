@@ -0,0 +1,158 @@
+package xmlrpc // import "wonderland.org/geneos/xmlrpc"
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EncryptedPrefix marks a value encrypted with a Geneos key file, as
+// stored in the Gateway setup for passwords and other secrets
+const EncryptedPrefix = "+encs+"
+
+// KeyFileEnv is the environment variable holding the path of the key
+// file used to decrypt parameters when SetKeyFile() has not been called
+const KeyFileEnv = "GENEOS_KEYFILE"
+
+// keyFile holds the AES-256 key and IV from a Geneos key file. The salt
+// is only needed to derive them from a passphrase so it is not kept.
+type keyFile struct {
+	key []byte
+	iv  []byte
+}
+
+var keyfile struct {
+	sync.Mutex
+	path string
+	kf   *keyFile
+}
+
+/*
+SetKeyFile reads the Geneos key file at path and uses it to decrypt
+"+encs+" parameter values from then on. The file is the one created by
+the Geneos tools and used by the Gateway, holding hex values in lines of
+the form:
+
+	salt=...
+	key=...
+	iv =...
+
+If SetKeyFile() is not called the file named by the GENEOS_KEYFILE
+environment variable is read when the first encrypted value is seen.
+*/
+func SetKeyFile(path string) (err error) {
+	kf, err := readKeyFile(path)
+	if err != nil {
+		return
+	}
+	keyfile.Lock()
+	keyfile.path, keyfile.kf = path, kf
+	keyfile.Unlock()
+	return
+}
+
+// KeyFile returns the path of the key file in use, if any
+func KeyFile() string {
+	keyfile.Lock()
+	defer keyfile.Unlock()
+	return keyfile.path
+}
+
+func readKeyFile(path string) (kf *keyFile, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	kf = &keyFile{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexByte(line, '=')
+		if i == -1 {
+			continue
+		}
+		name, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		var b []byte
+		if b, err = hex.DecodeString(value); err != nil {
+			return nil, fmt.Errorf("key file %q: %s: %w", path, name, err)
+		}
+		switch strings.ToLower(name) {
+		case "key":
+			kf.key = b
+		case "iv":
+			kf.iv = b
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(kf.key) != 32 {
+		return nil, fmt.Errorf("key file %q: key must be 32 bytes, found %d", path, len(kf.key))
+	}
+	if len(kf.iv) != aes.BlockSize {
+		return nil, fmt.Errorf("key file %q: iv must be %d bytes, found %d", path, aes.BlockSize, len(kf.iv))
+	}
+	return
+}
+
+// currentKeyFile returns the key file set by SetKeyFile() or, failing
+// that, the one named by KeyFileEnv
+func currentKeyFile() (*keyFile, error) {
+	keyfile.Lock()
+	defer keyfile.Unlock()
+	if keyfile.kf != nil {
+		return keyfile.kf, nil
+	}
+	path := os.Getenv(KeyFileEnv)
+	if path == "" {
+		return nil, fmt.Errorf("encrypted value but no key file, use SetKeyFile() or set %s", KeyFileEnv)
+	}
+	kf, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyfile.path, keyfile.kf = path, kf
+	return kf, nil
+}
+
+// Decrypt returns the plain text of a value encrypted with the key
+// file, AES-256-CBC with PKCS#7 padding. Values without the "+encs+"
+// prefix are returned unchanged.
+func Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, EncryptedPrefix) {
+		return value, nil
+	}
+	kf, err := currentKeyFile()
+	if err != nil {
+		return "", err
+	}
+	text, err := hex.DecodeString(strings.TrimPrefix(value, EncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("encrypted value: %w", err)
+	}
+	if len(text) == 0 || len(text)%aes.BlockSize != 0 {
+		return "", fmt.Errorf("encrypted value: length is not a multiple of the block size")
+	}
+	block, err := aes.NewCipher(kf.key)
+	if err != nil {
+		return "", err
+	}
+	plain := make([]byte, len(text))
+	cipher.NewCBCDecrypter(block, kf.iv).CryptBlocks(plain, text)
+
+	// remove the padding, checking it so the wrong key is reported
+	// rather than returning garbage
+	n := int(plain[len(plain)-1])
+	if n == 0 || n > aes.BlockSize || !bytes.Equal(plain[len(plain)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return "", fmt.Errorf("encrypted value: cannot decrypt, wrong key file?")
+	}
+	return string(plain[:len(plain)-n]), nil
+}
@@ -0,0 +1,154 @@
+package xmlrpc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// the key and iv of testKeyFile, with values encrypted by
+//
+//	openssl enc -aes-256-cbc -K $key -iv $iv
+const (
+	testKey = "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F"
+	testIV  = "F0E0D0C0B0A090807060504030201000"
+
+	testKeyFile = "salt=0011223344556677\nkey=" + testKey + "\niv =" + testIV + "\n"
+)
+
+// writeKeyFile writes contents to a file in a temporary directory
+func writeKeyFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// resetKeyFile forgets the key file in use
+func resetKeyFile() {
+	keyfile.Lock()
+	keyfile.path, keyfile.kf = "", nil
+	keyfile.Unlock()
+}
+
+func TestReadKeyFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		wantErr  string
+	}{
+		{"geneos", testKeyFile, ""},
+		{"lower case", strings.ToLower(testKeyFile), ""},
+		{"no salt", "key=" + testKey + "\niv=" + testIV + "\n", ""},
+		{"bad hex", "key=" + testKey[:63] + "X\niv=" + testIV + "\n", "key"},
+		{"short key", "key=00112233\niv=" + testIV + "\n", "key must be 32 bytes"},
+		{"no iv", "key=" + testKey + "\n", "iv must be 16 bytes"},
+		{"empty", "", "key must be 32 bytes"},
+	}
+	for _, tt := range tests {
+		kf, err := readKeyFile(writeKeyFile(t, "keyfile", tt.contents))
+		if tt.wantErr == "" {
+			if err != nil || len(kf.key) != 32 || len(kf.iv) != 16 {
+				t.Errorf("%s: readKeyFile() = %v, %v", tt.name, kf, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: readKeyFile() error %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+	if _, err := readKeyFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("readKeyFile() of a missing file: no error")
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	defer resetKeyFile()
+	resetKeyFile()
+	if err := SetKeyFile(writeKeyFile(t, "keyfile", testKeyFile)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"+encs+D95047439662BD6BB0790E5F5323E997", "s3cret!", false},
+		{"+encs+d95047439662bd6bb0790e5f5323e997", "s3cret!", false},
+		// a whole block of padding
+		{"+encs+EEF8D9828C494A177E573F14E7782A36F5014F3D03969D21FE745B05CFB278C0", "exactly16bytes!!", false},
+		{"plain text", "plain text", false},
+		{"", "", false},
+		{"+encs", "+encs", false},
+		{"+encs+", "", true},
+		{"+encs+XYZ", "", true},
+		{"+encs+D95047439662BD6BB0790E5F5323E9", "", true},
+		// the last block decrypts to bad padding
+		{"+encs+EEF8D9828C494A177E573F14E7782A36", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Decrypt(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Decrypt(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+
+	// the wrong key is reported rather than returning garbage
+	other := strings.Replace(testKeyFile, "000102", "FF0102", 1)
+	if err := SetKeyFile(writeKeyFile(t, "other", other)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Decrypt("+encs+D95047439662BD6BB0790E5F5323E997"); err == nil {
+		t.Errorf("Decrypt() with the wrong key = %q", got)
+	}
+
+	// a malformed key file leaves the one in use alone
+	path := KeyFile()
+	if err := SetKeyFile(writeKeyFile(t, "bad", "key=00\n")); err == nil {
+		t.Error("SetKeyFile() of a malformed file: no error")
+	}
+	if KeyFile() != path {
+		t.Errorf("KeyFile() = %q after a failed SetKeyFile(), want %q", KeyFile(), path)
+	}
+}
+
+func TestKeyFileEnv(t *testing.T) {
+	defer resetKeyFile()
+	resetKeyFile()
+	value := "+encs+D95047439662BD6BB0790E5F5323E997"
+
+	t.Setenv(KeyFileEnv, "")
+	if _, err := Decrypt(value); err == nil || !strings.Contains(err.Error(), KeyFileEnv) {
+		t.Errorf("Decrypt() with no key file: error %v", err)
+	}
+
+	env := writeKeyFile(t, "env", testKeyFile)
+	t.Setenv(KeyFileEnv, env)
+	if got, err := Decrypt(value); err != nil || got != "s3cret!" {
+		t.Errorf("Decrypt() with %s set = %q, %v", KeyFileEnv, got, err)
+	}
+	if KeyFile() != env {
+		t.Errorf("KeyFile() = %q, want %q", KeyFile(), env)
+	}
+
+	// SetKeyFile() takes precedence over the environment
+	option := writeKeyFile(t, "option", strings.Replace(testKeyFile, "000102", "FF0102", 1))
+	if err := SetKeyFile(option); err != nil {
+		t.Fatal(err)
+	}
+	if KeyFile() != option {
+		t.Errorf("KeyFile() = %q, want %q", KeyFile(), option)
+	}
+	if _, err := Decrypt(value); err == nil {
+		t.Error("Decrypt() used the key file from the environment, not SetKeyFile()")
+	}
+
+	resetKeyFile()
+	t.Setenv(KeyFileEnv, filepath.Join(t.TempDir(), "missing"))
+	if _, err := Decrypt(value); err == nil {
+		t.Error("Decrypt() with a missing key file: no error")
+	}
+}
@@ -0,0 +1,275 @@
+package xmlrpc // import "wonderland.org/geneos/xmlrpc"
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Typed getters for sampler parameters. The Netprobe does not distinguish
+between a parameter that is not set and one that is empty, so an empty
+parameter returns the zero value and no error. Leading and trailing
+spaces are ignored. Values encrypted with a Geneos key file, starting
+"+encs+", are decrypted first, see SetKeyFile().
+*/
+
+// ParameterString returns a parameter as a string, decrypting it if
+// needed. Use Parameter() for the value exactly as configured.
+func (s Sampler) ParameterString(name string) (value string, err error) {
+	value, _, err = s.parameterValue(name)
+	return
+}
+
+// ParameterInt returns a parameter as an int
+func (s Sampler) ParameterInt(name string) (i int, err error) {
+	err = s.parameterAs(name, &i)
+	return
+}
+
+// ParameterFloat returns a parameter as a float64
+func (s Sampler) ParameterFloat(name string) (f float64, err error) {
+	err = s.parameterAs(name, &f)
+	return
+}
+
+// ParameterBool returns a parameter as a bool. As well as the values
+// accepted by strconv.ParseBool it understands yes, no, on and off
+func (s Sampler) ParameterBool(name string) (b bool, err error) {
+	err = s.parameterAs(name, &b)
+	return
+}
+
+// ParameterDuration returns a parameter as a time.Duration. The value
+// is either a Go duration, e.g. "1m30s", or a plain number of seconds
+func (s Sampler) ParameterDuration(name string) (d time.Duration, err error) {
+	err = s.parameterAs(name, &d)
+	return
+}
+
+// ParameterList returns a comma separated parameter as a slice, with
+// spaces around each item and empty items removed
+func (s Sampler) ParameterList(name string) (l []string, err error) {
+	err = s.parameterAs(name, &l)
+	return
+}
+
+// ParameterJSON unmarshals a parameter holding JSON into v
+func (s Sampler) ParameterJSON(name string, v interface{}) error {
+	value, secret, err := s.parameterValue(name)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	if err = json.Unmarshal([]byte(value), v); err != nil {
+		return conversionError(name, secret, err)
+	}
+	return nil
+}
+
+// parameterValue returns a parameter, decrypted if needed. secret is
+// true if it was encrypted
+func (s Sampler) parameterValue(name string) (value string, secret bool, err error) {
+	if value, err = s.Parameter(name); err != nil {
+		return
+	}
+	value = strings.TrimSpace(value)
+	secret = strings.HasPrefix(value, EncryptedPrefix)
+	if value, err = Decrypt(value); err != nil {
+		err = fmt.Errorf("parameter %q: %w", name, err)
+	}
+	return
+}
+
+// conversionError reports a value that doesn't convert, leaving out the
+// error's detail for decrypted values as it usually includes the value
+func conversionError(name string, secret bool, err error) error {
+	if secret {
+		return fmt.Errorf("parameter %q: encrypted value is not valid for the type", name)
+	}
+	return fmt.Errorf("parameter %q: %w", name, err)
+}
+
+func (s Sampler) parameterAs(name string, v interface{}) error {
+	value, secret, err := s.parameterValue(name)
+	if err != nil {
+		return err
+	}
+	if err = setParameter(reflect.ValueOf(v).Elem(), value); err != nil {
+		return conversionError(name, secret, err)
+	}
+	return nil
+}
+
+/*
+LoadParameters sets the fields of the struct pointed to by v from the
+sampler parameters named in their param tags, e.g.
+
+	type Config struct {
+		URL     string         `param:"POWERWALL_URL,required"`
+		Timeout time.Duration  `param:"TIMEOUT,default=10s"`
+		Sites   []string       `param:"SITES,default=a,b"`
+		Verbose bool           `param:"VERBOSE"`
+		Limits  map[string]int `param:"LIMITS"`
+	}
+
+The default is used when the parameter is empty and, as it runs to the
+end of the tag unless followed by ",required", may contain commas. A
+required parameter that is empty, with no default, is an error. Fields
+are converted as the typed getters above and any type they don't handle,
+such as maps and structs, is unmarshalled from JSON. Encrypted values
+are decrypted. Fields without a param tag, or with param:"-", are left
+alone.
+
+All the fields are read before returning the first error, if any.
+*/
+func (s Sampler) LoadParameters(v interface{}) (err error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("LoadParameters(): not a pointer to a struct")
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		tag, ok := f.Tag.Lookup("param")
+		if !ok || tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		name, def, required := parseParamTag(tag)
+		if name == "" {
+			name = f.Name
+		}
+		value, secret, e := s.parameterValue(name)
+		if e == nil {
+			if strings.TrimSpace(value) == "" {
+				value = def
+			}
+			if required && strings.TrimSpace(value) == "" {
+				e = fmt.Errorf("required parameter %q not set", name)
+			} else if e = setParameter(rv.Field(i), value); e != nil {
+				e = conversionError(name, secret, e)
+			}
+		}
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// parseParamTag splits NAME,default=VALUE,required where VALUE may
+// contain commas
+func parseParamTag(tag string) (name string, def string, required bool) {
+	parts := strings.Split(tag, ",")
+	name = strings.TrimSpace(parts[0])
+	var defparts []string
+	indefault := false
+	for _, p := range parts[1:] {
+		switch {
+		case strings.TrimSpace(p) == "required":
+			required = true
+			indefault = false
+		case strings.HasPrefix(p, "default="):
+			defparts = []string{strings.TrimPrefix(p, "default=")}
+			indefault = true
+		case indefault:
+			defparts = append(defparts, p)
+		}
+	}
+	def = strings.Join(defparts, ",")
+	return
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setParameter converts value to the type of v and sets it. An empty
+// value sets the zero value
+func setParameter(v reflect.Value, value string) (err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	if v.Type() == durationType {
+		d, err := parseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem() == reflect.TypeOf("") {
+			v.Set(reflect.ValueOf(parseList(value)).Convert(v.Type()))
+			return
+		}
+		fallthrough
+	default:
+		p := reflect.New(v.Type())
+		if err = json.Unmarshal([]byte(value), p.Interface()); err != nil {
+			return
+		}
+		v.Set(p.Elem())
+	}
+	return
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// parseDuration accepts a Go duration or a number of seconds
+func parseDuration(value string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+func parseList(value string) (l []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			l = append(l, item)
+		}
+	}
+	return
+}
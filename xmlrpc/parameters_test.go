@@ -0,0 +1,85 @@
+package xmlrpc_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"wonderland.org/geneos/samplertest"
+	"wonderland.org/geneos/xmlrpc"
+)
+
+// encrypted values, see keyfile_test.go for the key file
+var encrypted = map[string]string{
+	"PASSWORD": "+encs+D95047439662BD6BB0790E5F5323E997", // s3cret!
+	"COUNT":    "+encs+54693344D9745C1699914D93E5E102D2", // 42
+	"TIMEOUT":  "+encs+BD15D53056FC5A733FCB9599C018559D", // 1m30s
+	"ENABLED":  "+encs+6C07D7977C7D0559C86901DF5C168654", // yes
+	"SITES":    "+encs+2C41D5F6673BD4204838DA15DDCF8489", // a,b
+}
+
+func TestEncryptedParameters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyfile")
+	keyfile := "salt=0011223344556677\n" +
+		"key=000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F\n" +
+		"iv =F0E0D0C0B0A090807060504030201000\n"
+	if err := os.WriteFile(path, []byte(keyfile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := xmlrpc.SetKeyFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	n := samplertest.NewNetprobe()
+	for name, value := range encrypted {
+		n.SetParameter(name, " "+value+" ")
+	}
+	n.SetParameter("PLAIN", "+encs+ is only a prefix here")
+	n.SetParameter("BADCOUNT", "+encs+2C41D5F6673BD4204838DA15DDCF8489") // a,b
+	c, err := n.Connection(samplertest.Entity, samplertest.Sampler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := c.ParameterString("PASSWORD"); err != nil || s != "s3cret!" {
+		t.Errorf("ParameterString() = %q, %v", s, err)
+	}
+	if s, err := c.Parameter("PASSWORD"); err != nil || strings.TrimSpace(s) != encrypted["PASSWORD"] {
+		t.Errorf("Parameter() = %q, %v, want the encrypted value", s, err)
+	}
+	if i, err := c.ParameterInt("COUNT"); err != nil || i != 42 {
+		t.Errorf("ParameterInt() = %d, %v", i, err)
+	}
+	if d, err := c.ParameterDuration("TIMEOUT"); err != nil || d != 90*time.Second {
+		t.Errorf("ParameterDuration() = %v, %v", d, err)
+	}
+	if b, err := c.ParameterBool("ENABLED"); err != nil || !b {
+		t.Errorf("ParameterBool() = %v, %v", b, err)
+	}
+	if l, err := c.ParameterList("SITES"); err != nil || !reflect.DeepEqual(l, []string{"a", "b"}) {
+		t.Errorf("ParameterList() = %q, %v", l, err)
+	}
+	if _, err := c.ParameterString("PLAIN"); err == nil {
+		t.Error("ParameterString() of a value that doesn't decrypt: no error")
+	}
+	// the error doesn't include the decrypted value
+	if _, err := c.ParameterInt("BADCOUNT"); err == nil || strings.Contains(err.Error(), "a,b") {
+		t.Errorf("ParameterInt() of an encrypted non-number: error %v", err)
+	}
+
+	var cfg struct {
+		Password string        `param:"PASSWORD,required"`
+		Count    int           `param:"COUNT"`
+		Timeout  time.Duration `param:"TIMEOUT,default=10s"`
+		Sites    []string      `param:"SITES"`
+	}
+	if err = c.LoadParameters(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Password != "s3cret!" || cfg.Count != 42 || cfg.Timeout != 90*time.Second || len(cfg.Sites) != 2 {
+		t.Errorf("LoadParameters() = %+v", cfg)
+	}
+}
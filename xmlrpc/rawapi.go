@@ -201,7 +201,7 @@ func (c Client) signOn(entity string, sampler string, seconds int) (err error) {
 }
 
 func (c Client) signOff(entity string, sampler string) (err error) {
-	method := strings.Join([]string{entity, sampler, "signOn"}, ".")
+	method := strings.Join([]string{entity, sampler, "signOff"}, ".")
 
 	return c.methodNoArgs(method)
 }
@@ -227,7 +227,7 @@ func (c Client) signOnStream(entity string, sampler string, stream string, secon
 }
 
 func (c Client) signOffStream(entity string, sampler string, stream string) (err error) {
-	method := strings.Join([]string{entity, sampler, stream, "signOn"}, ".")
+	method := strings.Join([]string{entity, sampler, stream, "signOff"}, ".")
 
 	return c.methodNoArgs(method)
 }
@@ -9,6 +9,7 @@ type Sampler struct {
 	Client
 	entityName  string
 	samplerName string
+	parameters  map[string]string // local values, see WithParameters()
 }
 
 func (s Sampler) ToString() string {
@@ -40,18 +41,33 @@ func (s Sampler) SamplerName() string {
 	return s.samplerName
 }
 
-// Parameter - Get a parameter from the Geneos sampler config as a string
-// It would not be difficult to add numberic and other type getters
+// Parameter - Get a parameter from the Geneos sampler config as a string.
+// There is no separate check that the sampler exists, the Netprobe
+// returns an error if it doesn't. See parameters.go for typed getters
 func (s Sampler) Parameter(name string) (string, error) {
 	DebugLogger.Print("called")
-
-	if !s.IsValid() {
-		err := fmt.Errorf("Parameter(): sampler doesn't exist")
-		return "", err
+	if value, ok := s.parameters[name]; ok {
+		return value, nil
 	}
 	return s.getParameter(s.EntityName(), s.SamplerName(), name)
 }
 
+// WithParameters returns a copy of the Sampler where Parameter(), and so
+// the typed getters, return the values in params rather than asking the
+// Netprobe. Other parameters are still read from the Netprobe. Values are
+// added to any set by earlier calls.
+func (s Sampler) WithParameters(params map[string]string) Sampler {
+	merged := make(map[string]string, len(s.parameters)+len(params))
+	for k, v := range s.parameters {
+		merged[k] = v
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	s.parameters = merged
+	return s
+}
+
 // SignOn to the sampler with the interval given
 func (s *Sampler) SignOn(interval time.Duration) error {
 	return s.signOn(s.EntityName(), s.SamplerName(), int(interval.Seconds()))